@@ -0,0 +1,211 @@
+// Package agent implements an agentic mode, where the model calls local tools in a loop before
+// giving its final answer.
+//
+// Tools are called with a fenced block containing a JSON object, described to the model by the
+// tool_calling instruction.
+// This does not rely on provider-specific function calling and therefore works with any model.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mooss/jen/go/ai/config"
+	"github.com/mooss/jen/go/ai/errs"
+	"github.com/mooss/jen/go/ai/jenai"
+	"github.com/mooss/jen/go/ai/prompts"
+	"github.com/mooss/jen/go/ai/tools"
+)
+
+// maxOutput is the maximum size of a tool output sent to the model.
+const maxOutput = 20000
+
+// Agent lets a model call tools until it gives its final answer.
+type Agent struct {
+	// Client sends the messages, the final answer is written to its output.
+	Client *jenai.Client
+	// Tools are the tools available to the model.
+	Tools tools.Set
+	// MaxSteps is the maximum number of tool calls.
+	MaxSteps int
+	// Log receives a line for each tool call, it can be nil.
+	Log io.Writer
+}
+
+// Call is a tool call requested by the model.
+type Call struct {
+	Name      string     `json:"name"`
+	Arguments tools.Args `json:"arguments"`
+}
+
+// Run sends the prompt and executes the tool calls of the model until it answers without calling
+// a tool.
+func (ag *Agent) Run(ctx context.Context, prompt jenai.Prompt) (jenai.Reply, error) {
+	if prompt.Empty() {
+		return jenai.Reply{}, errs.InputErr(errors.New("the prompt is empty"))
+	}
+
+	intro, err := prompts.NewEvalContext(ag.Client.Library, nil).
+		Instruction("tool_calling", ag.describe())
+	if err != nil {
+		return jenai.Reply{}, errs.PromptErr(err)
+	}
+
+	// Intermediate answers are tool calls, only the final one is written to the output.
+	client := *ag.Client
+	client.Output = nil
+	message := intro + "\n\n" + prompt.String()
+	// Without a session the model remembers nothing, the whole conversation is sent at each step.
+	conversation := message
+
+	for step := 0; ; step++ {
+		reply, err := client.Send(ctx, message)
+		if err != nil {
+			return jenai.Reply{}, err
+		}
+
+		call, found, err := parseCall(reply.Content)
+		if !found {
+			return reply, ag.output(reply.Content)
+		}
+
+		if step >= ag.MaxSteps {
+			return reply, errs.BackendErr(
+				fmt.Errorf("the model is still calling tools after %d steps", ag.MaxSteps))
+		}
+
+		message = ag.execute(ctx, call, err)
+		if step+1 == ag.MaxSteps {
+			message += "\n\nThis was the last tool call allowed, give your final answer now."
+		}
+		if client.Session.Name == "" {
+			conversation += "\n\n# Your previous answer\n\n" + reply.Content + "\n\n" + message
+			message = conversation
+		}
+	}
+}
+
+// execute runs the tool call and returns the message reporting its result to the model.
+// The call is recorded in the session.
+func (ag *Agent) execute(ctx context.Context, call Call, parseErr error) string {
+	record := config.ToolCall{Time: time.Now(), Name: call.Name, Arguments: call.Arguments}
+
+	result, err := "", parseErr
+	if err == nil {
+		result, err = ag.Tools.Call(ctx, call.Name, call.Arguments)
+	}
+
+	var message string
+	if err != nil {
+		record.Error = err.Error()
+		message = fmt.Sprintf("# The %s tool failed\n\n%s", call.Name, err)
+		ag.logf("tool %s failed: %s\n", call.Name, err)
+	} else {
+		record.Output = result
+		message = fmt.Sprintf("# Result of the %s tool\n\n%s", call.Name, truncate(result))
+		ag.logf("tool %s %s (%d bytes)\n", call.Name, compact(call.Arguments), len(result))
+	}
+
+	if err := ag.Client.Session.RecordToolCall(record); err != nil {
+		ag.logf("%s\n", err)
+	}
+
+	return message
+}
+
+// describe returns the description of the tools given to the model.
+func (ag *Agent) describe() string {
+	var buf strings.Builder
+	for _, tool := range ag.Tools.Sorted() {
+		fmt.Fprintf(&buf, "### %s\n\n%s\n\nArguments:\n", tool.Name, tool.Description)
+		for _, param := range tool.Params {
+			required := ""
+			if param.Required {
+				required = ", required"
+			}
+			fmt.Fprintf(&buf, "- %s (%s%s): %s\n", param.Name, typeName(param), required,
+				param.Description)
+		}
+		buf.WriteString("\n")
+	}
+
+	return strings.TrimSpace(buf.String())
+}
+
+func (ag *Agent) output(content string) error {
+	if ag.Client.Output == nil {
+		return nil
+	}
+
+	_, err := io.WriteString(ag.Client.Output, content)
+	return err
+}
+
+func (ag *Agent) logf(format string, args ...any) {
+	if ag.Log != nil {
+		fmt.Fprintf(ag.Log, format, args...)
+	}
+}
+
+///////////////////////
+// Utility functions //
+
+var callRegexp = regexp.MustCompile("(?s)```tool[ \t]*\n(.*?)\n```")
+
+// parseCall extracts the tool call from an answer.
+// Returns false when the answer does not contain a tool call, and an error when the call is
+// malformed.
+func parseCall(answer string) (Call, bool, error) {
+	match := callRegexp.FindStringSubmatch(answer)
+	if match == nil {
+		return Call{}, false, nil
+	}
+
+	var res Call
+	if err := json.Unmarshal([]byte(match[1]), &res); err != nil {
+		return Call{Name: "unknown"}, true, fmt.Errorf("invalid tool call: %w", err)
+	}
+
+	if res.Name == "" {
+		return Call{Name: "unknown"}, true, errors.New("invalid tool call: missing name")
+	}
+
+	return res, true, nil
+}
+
+func typeName(param tools.Param) string {
+	if param.Type == tools.Strings {
+		return "array of strings"
+	}
+
+	return param.Type
+}
+
+func truncate(output string) string {
+	if len(output) <= maxOutput {
+		return output
+	}
+
+	cut := maxOutput
+	for cut > 0 && !utf8.RuneStart(output[cut]) { // Runes are not split.
+		cut--
+	}
+
+	return output[:cut] + fmt.Sprintf("\n\n(truncated, %d bytes omitted)", len(output)-cut)
+}
+
+func compact(args tools.Args) string {
+	data, err := json.Marshal(args)
+	if err != nil {
+		return fmt.Sprint(args)
+	}
+
+	return string(data)
+}
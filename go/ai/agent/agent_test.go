@@ -0,0 +1,193 @@
+//nolint:revive
+package agent
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/mooss/jen/go/ai/config"
+	"github.com/mooss/jen/go/ai/jenai"
+	"github.com/mooss/jen/go/ai/models"
+	"github.com/mooss/jen/go/ai/prompts"
+	"github.com/mooss/jen/go/ai/tools"
+)
+
+// scripted is a fake model giving predefined answers and recording the messages it receives.
+type scripted struct {
+	answers  []string
+	messages []string
+}
+
+func (s *scripted) Send(_ context.Context, req jenai.Request, out io.Writer) (string, error) {
+	s.messages = append(s.messages, req.Message)
+	answer := s.answers[0]
+	if len(s.answers) > 1 {
+		s.answers = s.answers[1:]
+	}
+
+	_, err := io.WriteString(out, answer)
+	return answer, err
+}
+
+func toolBlock(json string) string { return "Let me look.\n```tool\n" + json + "\n```" }
+
+func newAgent(t *testing.T, answers ...string) (*Agent, *scripted, *bytes.Buffer) {
+	t.Helper()
+
+	lib, err := prompts.Embedded()
+	if err != nil {
+		t.Fatalf("Failed to load embedded prompts: %v", err)
+	}
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "notes.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	backend := &scripted{answers: answers}
+	session := config.SessionMetadata{Dir: t.TempDir(), Name: "test"}
+	client := jenai.New(lib, models.Spec{}, session)
+	client.Backend = backend
+	var out bytes.Buffer
+	client.Output = &out
+
+	toolbox := tools.Toolbox{Root: root}
+	return &Agent{Client: client, Tools: tools.NewSet(toolbox.Local()...), MaxSteps: 2}, backend, &out
+}
+
+func TestToolLoop(t *testing.T) {
+	ag, backend, out := newAgent(t,
+		toolBlock(`{"name": "read_file", "arguments": {"paths": ["notes.txt"]}}`),
+		toolBlock(`{"name": "read_file", "arguments": {"paths": ["../escape"]}}`),
+		"The notes say hello.",
+	)
+
+	reply, err := ag.Run(context.Background(), jenai.Prompt{Positional: "What do the notes say?"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if reply.Content != "The notes say hello." || out.String() != reply.Content {
+		t.Errorf("Expected only the final answer in the output, got %q (reply %q)",
+			out.String(), reply.Content)
+	}
+
+	if len(backend.messages) != 3 {
+		t.Fatalf("Expected 3 messages, got %d: %q", len(backend.messages), backend.messages)
+	}
+
+	expectations := []string{"## Available tools", "Result of the read_file tool", "failed"}
+	for i, expected := range expectations {
+		if !strings.Contains(backend.messages[i], expected) {
+			t.Errorf("Expected message %d to contain %q, got %q", i, expected, backend.messages[i])
+		}
+	}
+	if !strings.Contains(backend.messages[1], "hello") {
+		t.Errorf("Expected the file content in the tool result, got %q", backend.messages[1])
+	}
+	if !strings.Contains(backend.messages[2], "last tool call allowed") {
+		t.Errorf("Expected the last step to be announced, got %q", backend.messages[2])
+	}
+
+	log, err := os.ReadFile(ag.Client.Session.ToolLogPath())
+	if err != nil {
+		t.Fatalf("Failed to read tool log: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(log)), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"output"`) ||
+		!strings.Contains(lines[1], `"error"`) {
+		t.Errorf("Expected a success and a failure in the tool log, got %q", lines)
+	}
+}
+
+func TestMaxSteps(t *testing.T) {
+	ag, backend, _ := newAgent(t, toolBlock(`{"name": "list_dir", "arguments": {}}`))
+
+	_, err := ag.Run(context.Background(), jenai.Prompt{Positional: "Loop forever."})
+	if err == nil || !strings.Contains(err.Error(), "after 2 steps") {
+		t.Errorf("Expected the maximum number of steps to be reached, got %v", err)
+	}
+
+	if len(backend.messages) != 3 {
+		t.Errorf("Expected 3 messages (prompt and 2 tool results), got %d", len(backend.messages))
+	}
+}
+
+func TestWithoutSession(t *testing.T) {
+	call := toolBlock(`{"name": "read_file", "arguments": {"paths": ["notes.txt"]}}`)
+	ag, backend, _ := newAgent(t, call, call, "The notes say hello.")
+	ag.Client.Session = config.SessionMetadata{}
+
+	prompt := jenai.Prompt{Positional: "What do the notes say?"}
+	if _, err := ag.Run(context.Background(), prompt); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(backend.messages) != 3 {
+		t.Fatalf("Expected 3 messages, got %d", len(backend.messages))
+	}
+	last := backend.messages[2]
+	for _, expected := range []string{"What do the notes say?", "Your previous answer"} {
+		if !strings.Contains(last, expected) {
+			t.Errorf("Expected the conversation to contain %q, got %q", expected, last)
+		}
+	}
+	if strings.Count(last, "Result of the read_file tool") != 2 {
+		t.Errorf("Expected both tool results in the conversation, got %q", last)
+	}
+}
+
+func TestNegativeMaxSteps(t *testing.T) {
+	ag, backend, _ := newAgent(t, toolBlock(`{"name": "list_dir", "arguments": {}}`))
+	ag.MaxSteps = -1
+
+	if _, err := ag.Run(context.Background(), jenai.Prompt{Positional: "Loop."}); err == nil {
+		t.Errorf("Expected an error when the maximum number of steps is negative")
+	}
+	if len(backend.messages) != 1 {
+		t.Errorf("Expected no tool call to be run, got %d messages", len(backend.messages))
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	output := strings.Repeat("a", maxOutput-1) + "éé"
+	res := truncate(output)
+	if !utf8.ValidString(res) || !strings.HasPrefix(res, strings.Repeat("a", maxOutput-1)+"\n") {
+		t.Errorf("Expected the output to be cut before the split rune, got %q", res[maxOutput-4:])
+	}
+	if !strings.HasSuffix(res, "(truncated, 4 bytes omitted)") {
+		t.Errorf("Unexpected truncation note in %q", res[maxOutput-4:])
+	}
+}
+
+func TestParseCall(t *testing.T) {
+	tests := []struct {
+		name        string
+		answer      string
+		found       bool
+		expectError bool
+	}{
+		{"Final answer", "Just text, with ```go\ncode\n```.", false, false},
+		{"Tool call", toolBlock(`{"name": "grep", "arguments": {"pattern": "x"}}`), true, false},
+		{"Invalid JSON", toolBlock(`{"name": `), true, true},
+		{"Missing name", toolBlock(`{"arguments": {}}`), true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, found, err := parseCall(tt.answer)
+			if found != tt.found {
+				t.Errorf("Expected found to be %v for %q", tt.found, tt.answer)
+			}
+			if (err != nil) != tt.expectError {
+				t.Errorf("Unexpected error status for %q: %v", tt.answer, err)
+			}
+		})
+	}
+}
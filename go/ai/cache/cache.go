@@ -0,0 +1,105 @@
+// Package cache stores the answers of the models on disk, so that sending the same prompt to the
+// same model again does not pay the provider twice.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Entry is a cached answer.
+type Entry struct {
+	Created time.Time `json:"created"`
+	Model   string    `json:"model"`
+	Answer  string    `json:"answer"`
+}
+
+// Cache is a directory of answers indexed by key.
+type Cache struct {
+	Dir string
+	// TTL is the duration after which entries expire.
+	TTL time.Duration
+	// now returns the current time, it can be replaced in tests.
+	now func() time.Time
+}
+
+// New returns a cache stored in dir whose entries expire after ttl.
+func New(dir string, ttl time.Duration) *Cache {
+	return &Cache{Dir: dir, TTL: ttl, now: time.Now}
+}
+
+// Key returns the key of the parts, for instance the model and the prompt.
+func Key(parts ...string) string {
+	hash := sha256.New()
+	for _, part := range parts {
+		// Quoting keeps ("ab", "c") and ("a", "bc") apart.
+		data, _ := json.Marshal(part)
+		hash.Write(data)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Get returns the entry of the key, if it exists and has not expired.
+// Expired entries are removed.
+func (c *Cache) Get(key string) (Entry, bool) {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return Entry{}, false
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return Entry{}, false
+	}
+
+	if c.now().Sub(entry.Created) > c.TTL {
+		_ = os.Remove(c.path(key))
+		return Entry{}, false
+	}
+
+	return entry, true
+}
+
+// Put stores the entry under the key.
+// The creation date is set when it is missing.
+func (c *Cache) Put(key string, entry Entry) error {
+	if entry.Created.IsZero() {
+		entry.Created = c.now()
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	path := c.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	// Written then renamed so that concurrent readers never see a partial entry.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key[:2], key+".json")
+}
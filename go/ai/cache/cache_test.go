@@ -0,0 +1,49 @@
+//nolint:revive
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	c := New(t.TempDir(), time.Hour)
+	c.now = func() time.Time { return now }
+
+	key := Key("model", "prompt")
+	if key == Key("modelp", "rompt") || key != Key("model", "prompt") {
+		t.Fatalf("Expected keys to depend on the parts only")
+	}
+
+	if _, hit := c.Get(key); hit {
+		t.Fatalf("Expected a miss on an empty cache")
+	}
+	if err := c.Put(key, Entry{Model: "model", Answer: "answer"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		hit     bool
+	}{
+		{"Fresh", 0, true},
+		{"Before expiration", 59 * time.Minute, true},
+		{"Expired", 61 * time.Minute, false},
+		{"Removed once expired", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c.now = func() time.Time { return now.Add(tt.elapsed) }
+			entry, hit := c.Get(key)
+			if hit != tt.hit {
+				t.Fatalf("Expected hit to be %v", tt.hit)
+			}
+			if hit && (entry.Answer != "answer" || !entry.Created.Equal(now)) {
+				t.Errorf("Unexpected entry %+v", entry)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+// Package clipboard reads and writes the system clipboard through the tools of the environment:
+// wl-clipboard on Wayland, xclip or xsel on X11, pbcopy on macOS, tmux buffers, and OSC 52 escape
+// sequences as a last resort for writing.
+package clipboard
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// Clipboard reads and writes a clipboard.
+type Clipboard interface {
+	Read() (string, error)
+	Write(text string) error
+}
+
+// Command is a clipboard accessed with external commands.
+type Command struct {
+	Name string
+	// Paste prints the clipboard, Copy replaces it with its stdin.
+	Paste, Copy []string
+}
+
+// The clipboards accessed with commands.
+var (
+	Wayland = &Command{Name: "wayland",
+		Paste: []string{"wl-paste", "--no-newline"}, Copy: []string{"wl-copy"}}
+	Xclip = &Command{Name: "xclip",
+		Paste: []string{"xclip", "-o", "-selection", "clipboard"},
+		Copy:  []string{"xclip", "-i", "-selection", "clipboard"}}
+	Xsel = &Command{Name: "xsel",
+		Paste: []string{"xsel", "--clipboard", "--output"},
+		Copy:  []string{"xsel", "--clipboard", "--input"}}
+	MacOS = &Command{Name: "macos", Paste: []string{"pbpaste"}, Copy: []string{"pbcopy"}}
+	Tmux  = &Command{Name: "tmux",
+		Paste: []string{"tmux", "save-buffer", "-"}, Copy: []string{"tmux", "load-buffer", "-"}}
+)
+
+func (c *Command) Read() (string, error) {
+	output, err := exec.Command(c.Paste[0], c.Paste[1:]...).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get clipboard content with %s: %w", c.Name, err)
+	}
+
+	return string(output), nil
+}
+
+func (c *Command) Write(text string) error {
+	cmd := exec.Command(c.Copy[0], c.Copy[1:]...)
+	cmd.Stdin = strings.NewReader(text)
+	// The output is discarded rather than captured or inherited: xclip and wl-copy fork a child
+	// holding the clipboard, which would keep the pipes and the terminal of the caller open.
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to set clipboard content with %s: %w", c.Name, err)
+	}
+
+	return nil
+}
+
+// OSC52 writes to the clipboard of the terminal with an escape sequence, which works over SSH.
+// Terminals do not let programs read their clipboard this way.
+type OSC52 struct {
+	// Out is the terminal, /dev/tty when nil.
+	Out io.Writer
+	// Tmux wraps the sequence so that tmux passes it through to the terminal.
+	Tmux bool
+}
+
+func (OSC52) Read() (string, error) {
+	return "", errors.New("the clipboard cannot be read over OSC 52")
+}
+
+func (o OSC52) Write(text string) error {
+	sequence := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(text)) + "\a"
+	if o.Tmux {
+		sequence = "\x1bPtmux;" + strings.ReplaceAll(sequence, "\x1b", "\x1b\x1b") + "\x1b\\"
+	}
+
+	out := o.Out
+	if out == nil {
+		tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+		if err != nil {
+			return fmt.Errorf("failed to set clipboard content with OSC 52: %w", err)
+		}
+		defer tty.Close()
+		out = tty
+	}
+
+	_, err := io.WriteString(out, sequence)
+	return err
+}
+
+///////////////
+// Detection //
+
+// Clipboards are the clipboards that can be selected with the JENAI_CLIPBOARD environment
+// variable.
+var Clipboards = map[string]Clipboard{
+	"macos":   MacOS,
+	"osc52":   OSC52{},
+	"tmux":    Tmux,
+	"wayland": Wayland,
+	"xclip":   Xclip,
+	"xsel":    Xsel,
+}
+
+// Detect returns the clipboard of the environment, the one named by JENAI_CLIPBOARD if set.
+// Wayland and X11 are recognized by their display variables, macOS and tmux by their commands.
+// The command needed to write (or read) the clipboard must be installed.
+// OSC 52 is the fallback for writing, there is none for reading.
+func Detect(write bool) (Clipboard, error) {
+	if name := os.Getenv("JENAI_CLIPBOARD"); name != "" {
+		res, exists := Clipboards[name]
+		if !exists {
+			return nil, fmt.Errorf("unknown clipboard %q in JENAI_CLIPBOARD, expected one of %s",
+				name, strings.Join(slices.Sorted(maps.Keys(Clipboards)), ", "))
+		}
+		return res, nil
+	}
+
+	candidates := []struct {
+		variable string
+		command  *Command
+	}{
+		{"WAYLAND_DISPLAY", Wayland},
+		{"DISPLAY", Xclip},
+		{"DISPLAY", Xsel},
+		{"", MacOS},
+		{"TMUX", Tmux},
+	}
+	for _, candidate := range candidates {
+		if candidate.variable != "" && os.Getenv(candidate.variable) == "" {
+			continue
+		}
+
+		needed := candidate.command.Paste[0]
+		if write {
+			needed = candidate.command.Copy[0]
+		}
+		if _, err := exec.LookPath(needed); err == nil {
+			return candidate.command, nil
+		}
+	}
+
+	if !write {
+		return nil, errors.New("no command found to read the clipboard, install wl-clipboard, " +
+			"xclip or xsel, run in tmux, or select one with JENAI_CLIPBOARD")
+	}
+
+	return OSC52{Tmux: os.Getenv("TMUX") != ""}, nil
+}
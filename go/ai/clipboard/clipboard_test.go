@@ -0,0 +1,148 @@
+//nolint:revive
+package clipboard
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeCommands creates fake clipboard commands in a directory put on the PATH. Each command stores
+// the clipboard in a file shared by all of them, prefixed by its name when copying.
+func fakeCommands(t *testing.T, names ...string) {
+	// The PATH only holds the fakes, the other commands are called by absolute path.
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		t.Skip("cat is not available")
+	}
+
+	dir := t.TempDir()
+	store := filepath.Join(dir, "clipboard")
+	for _, name := range names {
+		script := "#!/bin/sh\ncase \"$*\" in\n" +
+			"  *-i*|*input*|load-buffer*) { printf " + name + ":; " + cat + "; } > " + store + " ;;\n" +
+			"  *) " + cat + " " + store + " ;;\nesac\n"
+		if name == "wl-copy" || name == "pbcopy" {
+			script = "#!/bin/sh\n{ printf " + name + ":; " + cat + "; } > " + store + "\n"
+		}
+		if name == "wl-paste" || name == "pbpaste" {
+			script = "#!/bin/sh\n" + cat + " " + store + "\n"
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands []string
+		env      map[string]string
+		expected string
+	}{
+		{"Wayland", []string{"wl-copy", "wl-paste", "xclip"},
+			map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"}, "wl-copy:"},
+		{"Wayland without wl-paste", []string{"wl-copy", "xclip"},
+			map[string]string{"WAYLAND_DISPLAY": "wayland-0", "DISPLAY": ":0"}, "wl-copy:"},
+		{"X11 without Wayland", []string{"wl-copy", "wl-paste", "xclip"},
+			map[string]string{"DISPLAY": ":0"}, "xclip:"},
+		{"xsel without xclip", []string{"xsel"}, map[string]string{"DISPLAY": ":0"}, "xsel:"},
+		{"macOS", []string{"pbcopy", "pbpaste", "tmux"}, map[string]string{"TMUX": "x"}, "pbcopy:"},
+		{"tmux", []string{"tmux", "xclip"}, map[string]string{"TMUX": "/tmp/tmux"}, "tmux:"},
+		{"Forced", []string{"xclip", "xsel"},
+			map[string]string{"DISPLAY": ":0", "JENAI_CLIPBOARD": "xsel"}, "xsel:"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, variable := range []string{"WAYLAND_DISPLAY", "DISPLAY", "TMUX", "JENAI_CLIPBOARD"} {
+				t.Setenv(variable, tt.env[variable])
+			}
+			fakeCommands(t, tt.commands...)
+
+			board, err := Detect(true)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if err := board.Write("answer"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if board, err = Detect(false); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			content, err := board.Read()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if content != tt.expected+"answer" {
+				t.Errorf("Expected %q, got %q", tt.expected+"answer", content)
+			}
+		})
+	}
+}
+
+func TestOSC52(t *testing.T) {
+	for _, variable := range []string{"WAYLAND_DISPLAY", "DISPLAY", "JENAI_CLIPBOARD"} {
+		t.Setenv(variable, "")
+	}
+	t.Setenv("TMUX", "/tmp/tmux")
+	fakeCommands(t)
+
+	if _, err := Detect(false); err == nil {
+		t.Errorf("Expected an error when no command can read the clipboard")
+	}
+
+	board, err := Detect(true)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	osc, ok := board.(OSC52)
+	if !ok || !osc.Tmux {
+		t.Fatalf("Expected OSC 52 wrapped for tmux, got %#v", board)
+	}
+	if _, err := osc.Read(); err == nil {
+		t.Errorf("Expected OSC 52 to be write-only")
+	}
+
+	var out bytes.Buffer
+	osc.Out = &out
+	if err := osc.Write("hi"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "\x1bPtmux;\x1b\x1b]52;c;aGk=\a\x1b\\"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+
+	t.Setenv("JENAI_CLIPBOARD", "clippy")
+	if _, err := Detect(true); err == nil {
+		t.Errorf("Expected an error for an unknown clipboard")
+	}
+}
+
+// TestForkingCommand checks that writing does not wait for the children keeping the clipboard,
+// as xclip and wl-copy do.
+func TestForkingCommand(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skip("sleep is not available")
+	}
+
+	copier := filepath.Join(t.TempDir(), "copy")
+	script := "#!/bin/sh\n" + sleep + " 10 &\n"
+	if err := os.WriteFile(copier, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if err := (&Command{Name: "fork", Copy: []string{copier}}).Write("answer"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the write to return without waiting for the child, took %s", elapsed)
+	}
+}
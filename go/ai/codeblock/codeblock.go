@@ -0,0 +1,224 @@
+// Package codeblock extracts the fenced code blocks of Markdown answers, so that answers meant to
+// be code can be used without the surrounding explanations.
+package codeblock
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mooss/jen/go/utils"
+)
+
+// Block is a fenced code block.
+type Block struct {
+	// Language is the first word of the info string, empty when there is none.
+	Language string
+	// Path is the file hinted in the header of the block, empty when there is none.
+	Path    string
+	Content string
+}
+
+// Modes are the extraction modes:
+//   - first keeps the first code block,
+//   - all keeps every code block,
+//   - files writes the blocks hinting a path to that path and keeps the others.
+var Modes = []string{"first", "all", "files"}
+
+// CheckMode returns an error if the mode is unknown.
+func CheckMode(mode string) error {
+	if mode != "" && !slices.Contains(Modes, mode) {
+		return fmt.Errorf("unknown extraction mode %q, expected one of %s",
+			mode, strings.Join(Modes, ", "))
+	}
+
+	return nil
+}
+
+// Parse returns the fenced code blocks of a Markdown text, in order.
+// Blocks are delimited by at least three backticks or tildes, the closing fence being at least as
+// long as the opening one, so that longer fences can wrap shorter ones.
+// An unclosed block runs until the end of the text.
+func Parse(text string) []Block {
+	var res []Block
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		fence, info, ok := openingFence(lines[i])
+		if !ok {
+			continue
+		}
+
+		block := headerBlock(info)
+		if block.Path == "" && i > 0 {
+			block.Path = previousPath(lines[:i])
+		}
+
+		end := i + 1
+		for end < len(lines) && !closes(lines[end], fence) {
+			end++
+		}
+
+		block.Content = strings.Join(lines[i+1:min(end, len(lines))], "\n")
+		res = append(res, block)
+		i = end
+	}
+
+	return res
+}
+
+// Filter returns the blocks written in the language, every block when language is empty.
+// Languages are compared case-insensitively.
+func Filter(blocks []Block, language string) []Block {
+	if language == "" {
+		return blocks
+	}
+
+	var res []Block
+	for _, block := range blocks {
+		if strings.EqualFold(block.Language, language) {
+			res = append(res, block)
+		}
+	}
+
+	return res
+}
+
+// Join returns the content of the blocks, separated by blank lines.
+func Join(blocks []Block) string {
+	contents := make([]string, len(blocks))
+	for i, block := range blocks {
+		contents[i] = strings.TrimSuffix(block.Content, "\n")
+	}
+
+	return strings.Join(contents, "\n\n")
+}
+
+// Write writes the blocks with a path to the working tree rooted at root.
+// Nothing is written when a path is not local to root, leaves it through a symbolic link, or is an
+// existing file while overwrite is false.
+func Write(root string, blocks []Block, overwrite bool) error {
+	for _, block := range blocks {
+		if err := checkPath(block.Path); err != nil {
+			return err
+		}
+		if err := utils.InTree(root, block.Path); err != nil {
+			return err
+		}
+		if _, err := os.Lstat(filepath.Join(root, block.Path)); err == nil && !overwrite {
+			return fmt.Errorf("%s: %w", block.Path, fs.ErrExist)
+		}
+	}
+
+	for _, block := range blocks {
+		path := filepath.Join(root, block.Path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		content := strings.TrimSuffix(block.Content, "\n") + "\n"
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkPath returns an error if the path is empty or escapes the working tree.
+func checkPath(path string) error {
+	if path == "" {
+		return errors.New("the code block does not hint a path")
+	}
+	if filepath.IsAbs(path) || !filepath.IsLocal(path) {
+		return fmt.Errorf("%s is outside of the working tree", path)
+	}
+
+	return nil
+}
+
+/////////////
+// Parsing //
+
+var (
+	fenceRegexp = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})(.*)$")
+	// pathAttribute matches the path of info strings such as go title="main.go".
+	pathAttribute = regexp.MustCompile(`^(?:path|file|filename|title)=["']?([^"']+)["']?$`)
+	// pathLine matches the lines introducing a block with a path, such as **main.go** or File: x.go.
+	pathLine = regexp.MustCompile("^(?i:file(?:name)?:\\s*)?[*_`]*([\\w./-]+\\.\\w+)[*_`]*:?$")
+	fileName = regexp.MustCompile(`^[\w-]+\.\w+$`)
+)
+
+// openingFence returns the fence and the info string of a line opening a code block.
+func openingFence(line string) (string, string, bool) {
+	match := fenceRegexp.FindStringSubmatch(line)
+	// Backtick fences cannot contain backticks in their info string.
+	if match == nil || (match[1][0] == '`' && strings.Contains(match[2], "`")) {
+		return "", "", false
+	}
+
+	return match[1], strings.TrimSpace(match[2]), true
+}
+
+// closes returns true when the line closes a block opened by fence.
+func closes(line, fence string) bool {
+	line = strings.TrimSpace(line)
+	return strings.HasPrefix(line, fence) && strings.Trim(line, fence[:1]) == ""
+}
+
+// headerBlock returns the language and the path of a block from its info string.
+// Paths are recognized in go:main.go, go path=main.go or go main.go, and as the whole info string
+// when it looks like a file name.
+func headerBlock(info string) Block {
+	var res Block
+	for i, field := range strings.Fields(info) {
+		if match := pathAttribute.FindStringSubmatch(field); match != nil {
+			res.Path = match[1]
+			continue
+		}
+
+		if i == 0 {
+			lang, path, found := strings.Cut(field, ":")
+			if found {
+				res.Language, res.Path = lang, path
+				continue
+			}
+			if !isPath(field) {
+				res.Language = field
+				continue
+			}
+		}
+
+		if res.Path == "" && isPath(field) {
+			res.Path = field
+		}
+	}
+
+	return res
+}
+
+// previousPath returns the path on the last non-empty line, empty when it is not a path alone.
+func previousPath(lines []string) string {
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+
+		if match := pathLine.FindStringSubmatch(line); match != nil {
+			return match[1]
+		}
+		return ""
+	}
+
+	return ""
+}
+
+// isPath returns true when the word looks like a file name: a directory or an extension.
+func isPath(word string) bool {
+	return strings.Contains(word, "/") || fileName.MatchString(word)
+}
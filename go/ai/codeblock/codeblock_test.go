@@ -0,0 +1,133 @@
+//nolint:revive
+package codeblock
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []Block
+	}{
+		{"No block", "Just text.", nil},
+		{"Language", "Here:\n```go\nfunc f() {}\n```\nDone.", []Block{{"go", "", "func f() {}"}}},
+		{"Several blocks", "```\na\n```\n\n~~~sh\nb\nc\n~~~", []Block{{"", "", "a"}, {"sh", "", "b\nc"}}},
+		{"Colon path", "```go:cmd/main.go\nx\n```", []Block{{"go", "cmd/main.go", "x"}}},
+		{"Attribute path", "```python title=\"a.py\"\nx\n```", []Block{{"python", "a.py", "x"}}},
+		{"Second word path", "```go main.go\nx\n```", []Block{{"go", "main.go", "x"}}},
+		{"Path only", "```main_test.go\nx\n```", []Block{{"", "main_test.go", "x"}}},
+		{"Previous line", "**src/a.rs**:\n\n```rust\nx\n```", []Block{{"rust", "src/a.rs", "x"}}},
+		{"Previous sentence", "See main.go below.\n```go\nx\n```", []Block{{"go", "", "x"}}},
+		{"Nested fences", "````md\n```go\nx\n```\n````", []Block{{"md", "", "```go\nx\n```"}}},
+		{"Unclosed", "```go\nx\ny", []Block{{"go", "", "x\ny"}}},
+		{"Inline backticks", "``` `not a fence` ```\ntext", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if res := Parse(tt.text); !reflect.DeepEqual(res, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, res)
+			}
+		})
+	}
+}
+
+func TestFilterAndJoin(t *testing.T) {
+	blocks := Parse("```go\na\n```\n```sh\nb\n```\n```Go\nc\n```")
+	if res := Join(Filter(blocks, "go")); res != "a\n\nc" {
+		t.Errorf("Expected the go blocks, got %q", res)
+	}
+	if res := Join(Filter(blocks, "")); res != "a\n\nb\n\nc" {
+		t.Errorf("Expected every block, got %q", res)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	root := t.TempDir()
+	if err := Write(root, []Block{{Path: "dir/a.go", Content: "package a"}}, false); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "dir/a.go")); string(data) != "package a\n" {
+		t.Errorf("Unexpected content %q", data)
+	}
+
+	blocks := []Block{{Path: "b.go", Content: "b"}, {Path: "../escape.go", Content: "x"}}
+	if err := Write(root, blocks, false); err == nil {
+		t.Errorf("Expected an error for a path outside of the root")
+	}
+	if _, err := os.Stat(filepath.Join(root, "b.go")); err == nil {
+		t.Errorf("Expected nothing to be written when a path is invalid")
+	}
+
+	blocks = []Block{{Path: "b.go", Content: "b"}, {Path: "dir/a.go", Content: "package b"}}
+	if err := Write(root, blocks, false); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Expected an error for an existing file, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "b.go")); err == nil {
+		t.Errorf("Expected nothing to be written when a file exists")
+	}
+	if err := Write(root, blocks, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "dir/a.go")); string(data) != "package b\n" {
+		t.Errorf("Expected the file to be overwritten, got %q", data)
+	}
+}
+
+func TestWriteSymlinks(t *testing.T) {
+	outside := t.TempDir()
+	root := t.TempDir()
+	links := map[string]string{
+		"inner":   "dir",
+		"escape":  outside,
+		"file.go": filepath.Join(outside, "file.go"),
+		"broken":  filepath.Join(outside, "missing"),
+	}
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(outside, "file.go"), []byte("original"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symbolic links are not available: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		path string
+		err  bool
+	}{
+		{"Inside through a link", "inner/a.go", false},
+		{"Linked directory", "escape/a.go", true},
+		{"Nested in a linked directory", "escape/sub/a.go", true},
+		{"Linked file", "file.go", true},
+		{"Broken link", "broken/a.go", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Write(root, []Block{{Path: tt.path, Content: "x"}}, true)
+			if (err != nil) != tt.err {
+				t.Errorf("Expected error: %v, got %v", tt.err, err)
+			}
+			entries, _ := os.ReadDir(outside)
+			data, _ := os.ReadFile(filepath.Join(outside, "file.go"))
+			if len(entries) != 1 || string(data) != "original" {
+				t.Errorf("Expected nothing to be written outside of the root, got %v", entries)
+			}
+		})
+	}
+	if _, err := os.Stat(filepath.Join(root, "dir/a.go")); err != nil {
+		t.Errorf("Expected the file to be written through the inner link: %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+// Package commit generates commit messages for the staged changes and commits them.
+package commit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/mooss/jen/go/ai/errs"
+	"github.com/mooss/jen/go/ai/jenai"
+)
+
+// Writer writes commit messages with a model.
+type Writer struct {
+	// Client sends the prompts, its session keeps the conversation across attempts.
+	Client *jenai.Client
+	// Conventional enforces the conventional commits format.
+	Conventional bool
+	// MaxAttempts is the maximum number of messages generated to respect the format.
+	MaxAttempts int
+	// Retry is called with the violation each time a message is rejected, it can be nil.
+	Retry func(err error)
+}
+
+// Write asks the model for the commit message of the prompt, which must render the staged diff.
+// In conventional mode, the model is asked again as long as its message violates the format.
+func (w *Writer) Write(ctx context.Context, prompt jenai.Prompt) (string, error) {
+	reply, err := w.Client.Ask(ctx, prompt)
+	if err != nil {
+		return "", err
+	}
+
+	for attempt := 1; ; attempt++ {
+		message := Clean(reply.Content)
+		if !w.Conventional {
+			return message, nil
+		}
+
+		violation := Conventional(message)
+		if violation == nil {
+			return message, nil
+		}
+
+		if attempt >= w.MaxAttempts {
+			return "", errs.BackendErr(fmt.Errorf(
+				"no conventional commit message after %d attempts: %w", attempt, violation))
+		}
+
+		if w.Retry != nil {
+			w.Retry(violation)
+		}
+
+		reply, err = w.Client.Send(ctx, fmt.Sprintf(
+			"This commit message does not follow the conventional commits format: %s.\n"+
+				"Write it again, with the commit message only.", violation))
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+/////////////
+// Message //
+
+// Clean extracts the commit message from an answer, removing the surrounding code fence.
+func Clean(answer string) string {
+	lines := strings.Split(strings.TrimSpace(answer), "\n")
+	if len(lines) >= 2 && strings.HasPrefix(lines[0], "```") &&
+		strings.TrimSpace(lines[len(lines)-1]) == "```" {
+		lines = lines[1 : len(lines)-1]
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n")) + "\n"
+}
+
+// Types are the types of commit accepted by Conventional.
+var Types = []string{
+	"build", "chore", "ci", "docs", "feat", "fix", "perf", "refactor", "revert", "style", "test",
+}
+
+var conventionalSubject = regexp.MustCompile(`^([a-z]+)(\([^()\s]+\))?!?: \S`)
+
+// Conventional returns an error describing why the message does not follow the conventional
+// commits format.
+func Conventional(message string) error {
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+	subject := lines[0]
+
+	match := conventionalSubject.FindStringSubmatch(subject)
+	switch {
+	case subject == "":
+		return errors.New("the message is empty")
+	case match == nil:
+		return fmt.Errorf("the subject %q is not of the form \"type(scope): description\"", subject)
+	case !slices.Contains(Types, match[1]):
+		return fmt.Errorf("unknown type %q, expected one of %s", match[1], strings.Join(Types, ", "))
+	case len(subject) > 72:
+		return fmt.Errorf("the subject is %d characters long, the maximum is 72", len(subject))
+	case len(lines) > 1 && strings.TrimSpace(lines[1]) != "":
+		return errors.New("the subject must be followed by an empty line")
+	}
+
+	return nil
+}
+
+/////////
+// Git //
+
+// Staged returns true when changes are staged in the repository of the working directory.
+func Staged(ctx context.Context) (bool, error) {
+	err := exec.CommandContext(ctx, "git", "diff", "--cached", "--quiet").Run()
+
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() == 1 {
+		return true, nil
+	}
+
+	return false, err
+}
+
+// Edit opens the message in the editor configured for git and returns the edited message.
+// Comment lines are removed, as git does.
+func Edit(ctx context.Context, message string) (string, error) {
+	editor, err := git(ctx, "var", "GIT_EDITOR")
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.CreateTemp("", "jenai-commit-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString(message +
+		"\n# Edit the commit message, an empty message aborts the commit.\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// Like git, let the shell interpret the editor command.
+	cmd := exec.CommandContext(ctx, "sh", "-c", strings.TrimSpace(editor)+` "$@"`, "editor",
+		file.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("editor failed: %w", err)
+	}
+
+	data, err := os.ReadFile(file.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return stripComments(string(data)), nil
+}
+
+// Save writes the message to COMMIT_EDITMSG in the git directory, as git does for the message of
+// the commit being made, and returns the path of the file.
+func Save(ctx context.Context, message string) (string, error) {
+	path, err := git(ctx, "rev-parse", "--git-path", "COMMIT_EDITMSG")
+	if err != nil {
+		return "", err
+	}
+
+	path = strings.TrimSpace(path)
+	return path, os.WriteFile(path, []byte(message), 0644)
+}
+
+// Commit commits the staged changes with the message, passing the extra arguments to git.
+func Commit(ctx context.Context, message string, args ...string) error {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"commit", "-F", "-"}, args...)...)
+	cmd.Stdin = strings.NewReader(message)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git commit failed: %w", err)
+	}
+
+	return nil
+}
+
+func stripComments(message string) string {
+	var buf strings.Builder
+	for _, line := range strings.Split(message, "\n") {
+		if !strings.HasPrefix(line, "#") {
+			buf.WriteString(line + "\n")
+		}
+	}
+
+	res := strings.TrimSpace(buf.String())
+	if res == "" {
+		return ""
+	}
+
+	return res + "\n"
+}
+
+func git(ctx context.Context, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %v failed: %w:\n%s", args, err, stderr.String())
+	}
+
+	return string(output), nil
+}
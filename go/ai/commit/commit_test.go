@@ -0,0 +1,130 @@
+//nolint:revive
+package commit
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mooss/jen/go/ai/config"
+	"github.com/mooss/jen/go/ai/jenai"
+	"github.com/mooss/jen/go/ai/models"
+	"github.com/mooss/jen/go/ai/prompts"
+)
+
+// scripted is a fake model giving predefined answers and recording the messages it receives.
+type scripted struct {
+	answers  []string
+	messages []string
+}
+
+func (s *scripted) Send(_ context.Context, req jenai.Request, out io.Writer) (string, error) {
+	s.messages = append(s.messages, req.Message)
+	answer := s.answers[0]
+	if len(s.answers) > 1 {
+		s.answers = s.answers[1:]
+	}
+
+	_, err := io.WriteString(out, answer)
+	return answer, err
+}
+
+func TestConventional(t *testing.T) {
+	tests := []struct {
+		message string
+		err     string // Part of the expected error, empty when valid.
+	}{
+		{"feat: add the commit command", ""},
+		{"fix(config)!: reject negative steps\n\nThey made no sense.", ""},
+		{"Add the commit command", "is not of the form"},
+		{"feature: add the commit command", "unknown type \"feature\""},
+		{"fix:missing space", "is not of the form"},
+		{"docs: " + strings.Repeat("a", 70), "characters long"},
+		{"fix: subject\nbody", "followed by an empty line"},
+		{"", "empty"},
+	}
+
+	for _, tt := range tests {
+		err := Conventional(tt.message)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("Expected %q to be valid, got %v", tt.message, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("Expected error containing %q for %q, got %v", tt.err, tt.message, err)
+		}
+	}
+}
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		answer   string
+		expected string
+	}{
+		{"Add tests", "Add tests\n"},
+		{"```\nAdd tests\n\nBody.\n```\n", "Add tests\n\nBody.\n"},
+		{"```text\nAdd tests\n```", "Add tests\n"},
+	}
+
+	for _, tt := range tests {
+		if got := Clean(tt.answer); got != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, got)
+		}
+	}
+}
+
+func TestWriteRegenerates(t *testing.T) {
+	lib, err := prompts.Embedded()
+	if err != nil {
+		t.Fatalf("Failed to load embedded prompts: %v", err)
+	}
+
+	newWriter := func(answers ...string) (*Writer, *scripted) {
+		backend := &scripted{answers: answers}
+		session := config.SessionMetadata{Dir: t.TempDir(), Name: "test"}
+		client := jenai.New(lib, models.Spec{}, session)
+		client.Backend = backend
+		return &Writer{Client: client, Conventional: true, MaxAttempts: 2}, backend
+	}
+	prompt := jenai.Prompt{Primary: "Write a commit message."}
+
+	writer, backend := newWriter("Add tests", "```\ntest: add tests\n```")
+	message, err := writer.Write(context.Background(), prompt)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if message != "test: add tests\n" {
+		t.Errorf("Expected the regenerated message, got %q", message)
+	}
+	if len(backend.messages) != 2 || !strings.Contains(backend.messages[1], "conventional") {
+		t.Errorf("Expected a second message reporting the violation, got %q", backend.messages)
+	}
+
+	writer, _ = newWriter("Add tests")
+	if _, err := writer.Write(context.Background(), prompt); err == nil ||
+		!strings.Contains(err.Error(), "after 2 attempts") {
+		t.Errorf("Expected an error after 2 attempts, got %v", err)
+	}
+}
+
+func TestSave(t *testing.T) {
+	dir := t.TempDir()
+	if err := exec.Command("git", "init", "-q", dir).Run(); err != nil {
+		t.Skipf("git is not available: %v", err)
+	}
+	t.Chdir(dir)
+
+	path, err := Save(context.Background(), "Edited message\n")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if path != filepath.Join(".git", "COMMIT_EDITMSG") {
+		t.Errorf("Expected the message to be saved in the git directory, got %s", path)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "Edited message\n" {
+		t.Errorf("Unexpected saved message %q", data)
+	}
+}
@@ -5,26 +5,168 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mooss/bagend/go/flag"
+	"github.com/mooss/jen/go/ai/clipboard"
+	"github.com/mooss/jen/go/ai/codeblock"
+	"github.com/mooss/jen/go/ai/errs"
+	"github.com/mooss/jen/go/ai/models"
 	"github.com/mooss/jen/go/ai/prompts"
 )
 
 type Jenai struct {
 	// Actual config.
+	Agent       Agent
+	Cache       Cache
 	Context     Context
+	Copy        bool
 	DryRun      bool
+	Extract     Extract
+	Format      string
 	Interactive bool
 	List        bool
 	ListModels  bool
+	MapReduce   MapReduce
 	Model       string
 	OneShot     bool
 	Paste       bool
+	Patch       Patch
 	Positional  []string
+	Secrets     Secrets
 	session     SessionMetadata
-	TeeFile     string
+	Tee         Tee
+
+	// Integer flags, parsed as strings and converted by ParseCLI.
+	intFlags []*intFlag
+}
+
+// Agent configures the agentic mode, where the model can call local tools.
+type Agent struct {
+	Enabled         bool
+	MaxSteps        int
+	AllowedCommands []string
+}
+
+// Cache configures the cache of the answers, enabled by --cache or the JENAI_CACHE environment
+// variable.
+type Cache struct {
+	Enabled  bool
+	Disabled bool
+	// Refresh asks the model again, replacing the cached answer.
+	Refresh bool
+	TTL     time.Duration
+	ttl     string
+}
+
+// Register registers the flags of the cache.
+func (c *Cache) Register(parser *flag.Parser) {
+	parser.Bool("cache", &c.Enabled, "Reuse the answers to identical prompts sent to the same model")
+	parser.String("cache-ttl", &c.ttl, "Duration after which cached answers expire").Default("24h")
+	parser.Bool("no-cache", &c.Disabled, "Disable the cache, even when JENAI_CACHE is set")
+	parser.Bool("refresh", &c.Refresh, "Ignore the cached answer and cache the new one")
+}
+
+// Parse parses the duration of the cache, to be called once the flags are parsed.
+func (c *Cache) Parse() error {
+	ttl, err := time.ParseDuration(c.ttl)
+	if err != nil || ttl <= 0 {
+		return fmt.Errorf("--cache-ttl expects a positive duration such as 12h, got %q", c.ttl)
+	}
+
+	c.TTL = ttl
+	return nil
+}
+
+// Active returns true when the answers should go through the cache.
+func (c *Cache) Active() bool {
+	return (c.Enabled || c.Refresh || os.Getenv("JENAI_CACHE") != "") && !c.Disabled
+}
+
+// Dir returns the directory of the cache.
+func (*Cache) Dir() string {
+	return filepath.Join(ProjectDir(), "cache")
+}
+
+// Extract configures the extraction of the code blocks of the answer, disabled when Mode is empty.
+type Extract struct {
+	Mode string
+	// Language keeps only the blocks written in this language.
+	Language string
+	// Overwrite lets the files mode replace existing files.
+	Overwrite bool
+}
+
+// MapReduce configures the map-reduce mode, where large inputs are processed in chunks.
+type MapReduce struct {
+	Enabled bool
+	// Map and Reduce are the names of the prompts run on the chunks and on the partial results.
+	Map, Reduce string
+	// Budget is the maximum number of tokens of a chunk.
+	Budget int
+	// Jobs is the number of chunks processed concurrently.
+	Jobs int
+}
+
+// Secrets configures what happens when the prompt contains secrets, blocking it by default.
+type Secrets struct {
+	// Allow sends the secrets as is.
+	Allow bool
+	// Redact replaces the secrets before sending the prompt.
+	Redact bool
+}
+
+// Register registers the flags of the secrets.
+func (s *Secrets) Register(parser *flag.Parser) {
+	parser.Bool("allow-secrets", &s.Allow,
+		"Send the prompt even when it contains secrets such as keys and tokens")
+	parser.Bool("redact-secrets", &s.Redact,
+		"Replace the secrets of the prompt instead of refusing to send it")
+}
+
+// Patch configures the patch mode, where the answer of the model is applied to the working tree.
+type Patch struct {
+	Enabled bool
+	// Yes applies the patch without asking for confirmation, it also applies to --extract files.
+	Yes bool
+	// Stage adds the patched files to the git index.
+	Stage bool
+}
+
+// Tee configures the copy of the answers written to a file.
+type Tee struct {
+	File   string
+	Format string
+	// Append adds to the file instead of overwriting it.
+	Append bool
+}
+
+// TeeFormats are the formats of the tee file: Markdown with a YAML front-matter, org-mode or JSON
+// lines.
+var TeeFormats = []string{"md", "org", "json"}
+
+// FileFormat returns the format of the tee file, inferred from its extension when not set.
+func (t Tee) FileFormat() (string, error) {
+	if t.Format == "" {
+		switch strings.ToLower(filepath.Ext(t.File)) {
+		case ".org":
+			return "org", nil
+		case ".json", ".jsonl":
+			return "json", nil
+		}
+		return "md", nil
+	}
+
+	if !slices.Contains(TeeFormats, t.Format) {
+		return "", fmt.Errorf("unknown tee format %q, expected one of %s",
+			t.Format, strings.Join(TeeFormats, ", "))
+	}
+
+	return t.Format, nil
 }
 
 /////////////////////////////////
@@ -32,27 +174,79 @@ type Jenai struct {
 
 func (conf *Jenai) RegisterCLI() *flag.Parser {
 	parser := flag.NewParser()
+	parser.Bool("agent", &conf.Agent.Enabled, "Let the model call local tools before answering")
+	conf.Cache.Register(parser)
+	conf.Secrets.Register(parser)
+	parser.StringSlice("allow-cmd", &conf.Agent.AllowedCommands,
+		"Commands that the model can run in agentic mode")
+	parser.Bool("auto-context", &conf.Context.Auto,
+		"Include the repository files most relevant to the prompt as context")
+	conf.registerInt(parser, "auto-context-budget", &conf.Context.AutoBudget,
+		"Maximum number of tokens of the files included by --auto-context", "20000")
+	conf.registerInt(parser, "budget", &conf.MapReduce.Budget,
+		"Maximum number of tokens of a chunk in map-reduce mode", "8000")
 	parser.Bool("context-above", &conf.Context.Above,
 		"Put context files and dir above instructions")
+	parser.String("context-format", &conf.Context.Format,
+		"Framing of the context: framed, json, markdown or xml (default from the model or framed)")
+	parser.Bool("copy", &conf.Copy, "Copy the answer to the clipboard")
 	parser.StringSlice("dir", &conf.Context.Dirs, "Include all files in directory as context")
 	parser.Bool("dry-run", &conf.DryRun, "Print interpolated prompt without sending to LLM").
 		Alias("n")
-	parser.StringSlice("file", &conf.Context.Files, "Include specific file(s) as context")
+	conf.Context.Embeddings.Register(parser)
+	parser.String("extract", &conf.Extract.Mode,
+		"Keep only the code blocks of the answer: first, all, or files to write them to the path "+
+			"in their header")
+	parser.String("extract-lang", &conf.Extract.Language,
+		"Keep only the code blocks in this language with --extract")
+	parser.StringSlice("file", &conf.Context.Files,
+		"Include specific file(s) as context, or parts of them with path:START-END or path#GoFunc")
+	parser.String("format", &conf.Format,
+		"Output format of review findings: text, sarif or github").Default("text")
+	parser.StringSlice("image", &conf.Context.Images,
+		"Attach image file(s) or URL(s) to the request, for models with vision")
 	parser.Bool("interactive", &conf.Interactive, "Start an interactive aichat session").
 		Alias("i")
+	conf.registerInt(parser, "jobs", &conf.MapReduce.Jobs,
+		"Number of chunks processed concurrently in map-reduce mode", "4")
 	parser.Bool("list", &conf.List, "list all available prompts").
 		Alias("l")
 	parser.Bool("list-models", &conf.ListModels, "list all available models").
 		Alias("lm")
 	parser.Bool("linum", &conf.Context.LineNumbers, "Print files with line numbers")
+	parser.String("map", &conf.MapReduce.Map, "Prompt run on each chunk in map-reduce mode").
+		Default("map_summary")
+	parser.Bool("map-reduce", &conf.MapReduce.Enabled,
+		"Split large inputs in chunks, map a prompt on each and reduce the results")
+	conf.registerInt(parser, "max-steps", &conf.Agent.MaxSteps,
+		"Maximum number of tool calls in agentic mode", "10")
 	parser.String("model", &conf.Model, "Model name (short name from --lm or provider:author/model)").
 		Alias("m").Default("ds3.2")
 	parser.Bool("oneshot", &conf.OneShot, "Use positional arguments as the prompt").
 		Alias("o")
+	parser.String("order", &conf.Context.Order,
+		"Order of the context files: given, alpha, dir or mtime").Default("given")
+	parser.Bool("overwrite", &conf.Extract.Overwrite,
+		"Let --extract files replace existing files")
 	parser.Bool("paste", &conf.Paste, "Use clipboard content as prompt")
+	parser.Bool("patch", &conf.Patch.Enabled,
+		"Ask for a patch and apply it to the working tree after confirmation")
+	parser.String("reduce", &conf.MapReduce.Reduce,
+		"Prompt merging the partial results in map-reduce mode").Default("reduce_summary")
+	conf.registerInt(parser, "rag", &conf.Context.RAG,
+		"Include the K chunks of the embeddings index closest to the prompt as context", "0")
+	parser.StringSlice("repo-map", &conf.Context.RepoMaps,
+		"Include an outline of the Go packages under directory as context")
 	parser.String("session", &conf.session.Name,
 		"Reuse or create specific session name (/last for most recent session)")
-	parser.String("tee", &conf.TeeFile, "Output first answer to both stdout and FILE (overwritten)")
+	parser.Bool("stage", &conf.Patch.Stage, "Stage the files changed by --patch with git")
+	parser.String("tee", &conf.Tee.File,
+		"Output first answer (whole conversation with --interactive) to both stdout and FILE")
+	parser.Bool("tee-append", &conf.Tee.Append, "Append to the --tee file instead of overwriting it")
+	parser.String("tee-format", &conf.Tee.Format,
+		"Format of the --tee file: md, org or json (default from the extension or md)")
+	parser.Bool("yes", &conf.Patch.Yes,
+		"Apply the patch or write the extracted files without confirmation").Alias("y")
 
 	return parser
 }
@@ -60,65 +254,86 @@ func (conf *Jenai) RegisterCLI() *flag.Parser {
 // ParseCLI fills the fields from CLI arguments.
 func (conf *Jenai) ParseCLI(parser *flag.Parser, args []string) error {
 	if err := parser.Parse(args); err != nil {
-		return err
+		return errs.InputErr(err)
+	}
+
+	for _, num := range conf.intFlags {
+		if err := num.convert(); err != nil {
+			return errs.InputErr(err)
+		}
+	}
+
+	if err := conf.Cache.Parse(); err != nil {
+		return errs.InputErr(err)
+	}
+	if err := CheckOrder(conf.Context.Order); err != nil {
+		return errs.InputErr(err)
+	}
+	if err := codeblock.CheckMode(conf.Extract.Mode); err != nil {
+		return errs.InputErr(err)
+	}
+	if _, err := conf.Tee.FileFormat(); err != nil {
+		return errs.InputErr(err)
+	}
+	if conf.Context.Format != "" {
+		if _, err := RendererFor(conf.Context.Format); err != nil {
+			return errs.InputErr(err)
+		}
 	}
 
 	conf.Positional = parser.Positional
 	return nil
 }
 
+// registerInt registers an integer flag.
+func (conf *Jenai) registerInt(parser *flag.Parser, name string, dest *int, help, def string) {
+	num := &intFlag{name: name, dest: dest}
+	conf.intFlags = append(conf.intFlags, num)
+	parser.String(name, &num.raw, help).Default(def)
+}
+
 // BuildPrompt returns the complete prompt, taking all sources into account (prompt, clipboard,
 // positional argument, and stdin).
 // Prompt and clipboard are mutually exclusive.
 // The prompt is evaluated.
 func (conf *Jenai) BuildPrompt(lib prompts.Library) (Prompt, error) {
-	var (
-		clipboard  string
-		context    string
-		paths      []string
-		err        error
-		positional []string
-		primary    string
-		stdin      string
-	)
-
-	positional = conf.Positional
+	opts, err := conf.PromptOptions()
+	if err != nil {
+		return Prompt{}, err
+	}
+
+	return opts.Build(lib)
+}
+
+// PromptOptions gathers the sources of the prompt described by the CLI, reading the clipboard and
+// stdin when needed.
+func (conf *Jenai) PromptOptions() (Options, error) {
+	var err error
+	opts := Options{Args: conf.Positional, Context: conf.Context}
+	// An unknown model keeps the default format, it is reported when the model is contacted, which
+	// does not happen with --dry-run.
+	if spec, err := models.Resolve(conf.Model); opts.Context.Format == "" && err == nil {
+		opts.Context.Format = spec.ContextFormat
+	}
+
 	if !conf.OneShot && len(conf.Positional) > 0 {
-		positional = conf.Positional[1:]
-		primary, err = prompts.NewEvalContext(lib, &positional).Evaluate(conf.Positional[0])
-		if err != nil {
-			return Prompt{}, err
-		}
+		opts.Name = conf.Positional[0]
+		opts.Args = conf.Positional[1:]
 	}
 
 	if conf.Paste {
-		clipboard, err = readClipboard()
+		opts.Clipboard, err = readClipboard()
 		if err != nil {
-			return Prompt{}, err
+			return Options{}, errs.InputErr(err)
 		}
 	}
 
-	context, paths, err = conf.Context.Build()
+	opts.Stdin, err = readStdin()
 	if err != nil {
-		return Prompt{}, err
-	}
-
-	stdin, err = readStdin()
-	if err != nil {
-		return Prompt{}, err
-	}
-
-	res := Prompt{
-		Clipboard:    clipboard,
-		Context:      context,
-		ContextAbove: conf.Context.Above,
-		Paths:        paths,
-		Positional:   strings.Join(positional, " "),
-		Primary:      primary,
-		Stdin:        stdin,
+		return Options{}, errs.InputErr(err)
 	}
 
-	return res, nil
+	return opts, nil
 }
 
 /////////////
@@ -127,9 +342,11 @@ func (conf *Jenai) BuildPrompt(lib prompts.Library) (Prompt, error) {
 // Session returns a session object to manipulate a chat session.
 func (conf *Jenai) Session() (SessionMetadata, error) {
 	if conf.session.Dir == "" {
-		if err := conf.session.prepare(); err != nil {
+		session, err := NewSession(conf.session.Name)
+		if err != nil {
 			return SessionMetadata{}, err
 		}
+		conf.session = session
 	}
 
 	return conf.session, nil
@@ -138,15 +355,31 @@ func (conf *Jenai) Session() (SessionMetadata, error) {
 ///////////////////////
 // Utility functions //
 
+// intFlag is an integer flag, parsed as a string.
+type intFlag struct {
+	name string
+	raw  string
+	dest *int
+}
+
+func (num *intFlag) convert() error {
+	value, err := strconv.Atoi(num.raw)
+	if err != nil {
+		return fmt.Errorf("--%s expects an integer, got %q", num.name, num.raw)
+	}
+
+	*num.dest = value
+	return nil
+}
+
 // readClipboard returns the content of the clipboard.
 func readClipboard() (string, error) {
-	cmd := exec.Command("xclip", "-o", "-selection", "clipboard")
-	output, err := cmd.Output()
+	board, err := clipboard.Detect(false)
 	if err != nil {
-		return "", fmt.Errorf("failed to get clipboard content: %w", err)
+		return "", err
 	}
 
-	return string(output), nil
+	return board.Read()
 }
 
 // readStdin returns the content of stdin, if something was piped in.
@@ -2,7 +2,8 @@ package config
 
 import (
 	"bufio"
-	"bytes"
+	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
@@ -12,6 +13,14 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/mooss/bagend/go/flag"
+	"github.com/mooss/jen/go/ai/extract"
+	"github.com/mooss/jen/go/ai/index"
+	"github.com/mooss/jen/go/ai/repomap"
+	"github.com/mooss/jen/go/ai/secrets"
 )
 
 ///////////////////
@@ -19,42 +28,211 @@ import (
 
 // Context handles inclusion of files and directories as context.
 type Context struct {
-	Files       []string
-	Dirs        []string
+	Files []string
+	Dirs  []string
+	// Images are attached to the request rather than included as text.
+	Images []string
+	// RepoMaps are the directories whose Go packages are outlined.
+	RepoMaps    []string
 	Above       bool
 	LineNumbers bool
+	// Format is the name of the renderer of the context, see Renderers.
+	Format string
+	// Order is the ordering strategy of the files, see Orders.
+	Order string
+	// Auto includes the repository files most relevant to the prompt, within AutoBudget tokens.
+	Auto       bool
+	AutoBudget int
+	// RAG is the number of chunks retrieved from the embeddings index, embedded with Embeddings.
+	RAG        int
+	Embeddings Embeddings
+
+	// chunks are the retrieved chunks.
+	chunks []*index.Chunk
+}
+
+// Embeddings selects the embedder of the embeddings index.
+type Embeddings struct {
+	// Embedder is "hash" or the base URL of an OpenAI-compatible API.
+	Embedder string
+	Model    string
+	// Secrets is applied to the texts sent to an embeddings API.
+	Secrets secrets.Policy
+}
+
+// Register registers the flags of the embedder.
+func (e *Embeddings) Register(parser *flag.Parser) {
+	parser.String("embedder", &e.Embedder,
+		"Embedder of the index: hash or the base URL of an OpenAI-compatible API").Default("hash")
+	parser.String("embedding-model", &e.Model, "Model of the embeddings API").
+		Default("text-embedding-3-small")
+}
+
+// New returns the embedder, authenticated with the JENAI_EMBEDDINGS_KEY environment variable.
+// The texts embedded by an API go through the secret policy.
+func (e Embeddings) New() (index.Embedder, error) {
+	embedder, err := index.NewEmbedder(e.Embedder, e.Model, os.Getenv("JENAI_EMBEDDINGS_KEY"))
+	if err != nil {
+		return nil, err
+	}
+	if _, local := embedder.(index.Hashing); local {
+		return embedder, nil
+	}
+	return index.Screened{Embedder: embedder, Secrets: e.Secrets}, nil
 }
 
-func (c *Context) Empty() bool { return len(c.Files) == 0 && len(c.Dirs) == 0 }
+func (c *Context) Empty() bool {
+	return len(c.Files) == 0 && len(c.Dirs) == 0 && len(c.RepoMaps) == 0 && len(c.chunks) == 0
+}
 
-// Build returns the context string from included paths and the included paths.
-// Empty should be checked before calling this because the "additional context" header is always
-// present,
-func (c *Context) Build() (string, []string, error) {
+// Build returns the context string from included paths and the included paths, rendered in the
+// selected format.
+func (c *Context) Build() (string, []PathInfo, error) {
 	if c.Empty() {
 		return "", nil, nil
 	}
 
-	var buf bytes.Buffer
-	paths := []string{}
-	buf.WriteString("# Additional context (files)")
+	renderer, err := RendererFor(c.Format)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var sections []Section
+	paths := []PathInfo{}
 
-	for path, err := range c.allPaths {
+	files, err := c.orderedPaths()
+	if err != nil {
+		return "", nil, c.wrap(err)
+	}
+
+	for _, path := range files {
+		section, info, err := fileSection(path, c.LineNumbers)
 		if err != nil {
 			return "", nil, c.wrap(err)
 		}
 
-		if err := fileContent(&buf, path, c.LineNumbers); err != nil {
+		sections = append(sections, section)
+		paths = append(paths, info)
+	}
+
+	for _, chunk := range c.chunks {
+		text := strings.TrimSuffix(chunk.Text, "\n")
+		if c.LineNumbers {
+			var buf strings.Builder
+			for i, line := range strings.Split(text, "\n") {
+				fmt.Fprintf(&buf, "%d: %s\n", chunk.Start+i, line)
+			}
+			text = buf.String()
+		}
+
+		sections = append(sections, Section{Name: chunk.Name(), Path: chunk.Path, Content: text})
+		paths = append(paths, pathInfo(chunk.Name(), []byte(chunk.Text)))
+	}
+
+	for _, root := range c.RepoMaps {
+		packages, err := repomap.Outline(root)
+		if err != nil {
 			return "", nil, c.wrap(err)
 		}
 
-		paths = append(paths, path)
+		section := Section{
+			Name:    "repo map of " + root,
+			Content: strings.TrimRight(repomap.Render(packages), "\n"),
+		}
+		sections = append(sections, section)
+		paths = append(paths, pathInfo(root, []byte(section.Content)))
+	}
+
+	return renderer.Render(sections), paths, nil
+}
+
+// addRelevant adds the files of the project most relevant to the query to the context, ranked by
+// the lexical index.
+func (c *Context) addRelevant(query string) error {
+	root := ProjectRoot()
+	idx, err := index.Open(root)
+	if err != nil {
+		return fmt.Errorf("failed to index repository: %w", err)
 	}
 
-	return buf.String(), paths, nil
+	included := map[string]bool{}
+	for _, path := range c.Files {
+		included[filepath.Clean(path)] = true
+	}
+
+	// The index is relative to the root, the context to the current directory.
+	var results []index.Result
+	paths := map[string]string{}
+	for _, result := range idx.Search(query) {
+		path, err := fromRoot(root, result.Path)
+		if err != nil {
+			return err
+		}
+		if !included[path] {
+			results = append(results, result)
+			paths[result.Path] = path
+		}
+	}
+
+	for _, rel := range idx.Select(results, c.AutoBudget) {
+		c.Files = append(c.Files, paths[rel])
+	}
+	return nil
 }
 
-// allPaths returns an iterator on all paths contained in the context.
+// retrieve retrieves the chunks of the project closest to the query from the embeddings index.
+func (c *Context) retrieve(query string) error {
+	embedder, err := c.Embeddings.New()
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	root := ProjectRoot()
+	store, err := index.OpenStore(ctx, root, embedder)
+	if err != nil {
+		return fmt.Errorf("failed to index repository: %w", err)
+	}
+
+	chunks, err := store.Retrieve(ctx, embedder, query, c.RAG)
+	if err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		rel := *chunk
+		if rel.Path, err = fromRoot(root, chunk.Path); err != nil {
+			return err
+		}
+		c.chunks = append(c.chunks, &rel)
+	}
+	return nil
+}
+
+// imageExtensions are the extensions of the images that can be attached.
+var imageExtensions = []string{".gif", ".jpeg", ".jpg", ".png", ".webp"}
+
+// checkImages checks that the images are URLs or existing image files.
+func (c *Context) checkImages() error {
+	for _, image := range c.Images {
+		if isURL(image) {
+			continue
+		}
+
+		if !slices.Contains(imageExtensions, strings.ToLower(filepath.Ext(image))) {
+			return fmt.Errorf("%s is not an image, expected one of %s",
+				image, strings.Join(imageExtensions, ", "))
+		}
+		if _, err := os.Stat(image); err != nil {
+			return fmt.Errorf("cannot attach image: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// allPaths returns an iterator on all paths contained in the context, in the order of the
+// arguments.
 func (c *Context) allPaths(yield func(string, error) bool) {
 	for _, path := range c.Files {
 		if !yield(path, nil) {
@@ -78,37 +256,68 @@ func (*Context) wrap(err error) error {
 ///////////////////////
 // Utility functions //
 
-// fileContent reads a file or URL and fills the buffer with its content, along with a header.
+// fromRoot converts a path relative to the root of the project to a path relative to the current
+// directory.
+func fromRoot(root, rel string) (string, error) {
+	if root == "." {
+		return rel, nil
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(wd); err == nil { // Git resolves the root.
+		wd = resolved
+	}
+
+	return filepath.Rel(wd, filepath.Join(root, rel))
+}
+
+// fileSection reads a file or URL and returns its text as a section.
+// The spec can restrict the file to a range of lines or to a Go declaration, see parseScope.
+// Documents such as PDFs are converted to plain text.
 //
 //nolint:revive
-func fileContent(buf *bytes.Buffer, path string, linum bool) error {
+func fileSection(spec string, linum bool) (Section, PathInfo, error) {
+	scope := parseScope(spec)
+	path := scope.path
 	reader, err := readContent(path)
 	if err != nil {
-		return fmt.Errorf("error reading content from %s: %w", path, err)
+		return Section{}, PathInfo{}, fmt.Errorf("error reading content from %s: %w", path, err)
 	}
 	defer reader.Close()
 
-	buf.WriteString("\n\n====> START OF " + path + " <====\n\n")
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return Section{}, PathInfo{}, fmt.Errorf("error reading content from %s: %w", path, err)
+	}
+
+	text, lineNumber, err := scope.apply(extract.Text(path, data))
+	if err != nil {
+		return Section{}, PathInfo{}, err
+	}
 
-	if linum {
-		scanner := bufio.NewScanner(reader)
-		lineNumber := 1
+	if linum { // The numbers of the original file are kept.
+		var buf strings.Builder
+		scanner := bufio.NewScanner(strings.NewReader(text))
 		for scanner.Scan() {
 			buf.WriteString(fmt.Sprintf("%d: %s\n", lineNumber, scanner.Text()))
 			lineNumber++
 		}
 		if err := scanner.Err(); err != nil {
-			return fmt.Errorf("error reading content from %s line by line: %w", path, err)
-		}
-	} else {
-		_, err := io.Copy(buf, reader)
-		if err != nil {
-			return fmt.Errorf("error writing content to buffer for %s: %w", path, err)
+			return Section{}, PathInfo{},
+				fmt.Errorf("error reading content from %s line by line: %w", path, err)
 		}
+		text = buf.String()
 	}
 
-	buf.WriteString("\n\n====> END OF " + path + " <====")
-	return nil
+	return Section{Name: spec, Path: path, Content: text}, pathInfo(spec, data), nil
+}
+
+// pathInfo returns the description of an included path from the content read.
+func pathInfo(path string, data []byte) PathInfo {
+	return PathInfo{Path: path, Size: int64(len(data)), Hash: fmt.Sprintf("%x", sha256.Sum256(data))}
 }
 
 // readContent returns an io.Reader for the given path, which can be a local file or a URL.
@@ -0,0 +1,60 @@
+//nolint:revive
+package config
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAutoContextFromSubdirectory(t *testing.T) {
+	root := t.TempDir()
+	if err := exec.Command("git", "init", "-q", root).Run(); err != nil {
+		t.Skipf("git is not available: %v", err)
+	}
+	files := map[string]string{
+		"lib/zebra.go":  "package lib\n\nfunc Zebra() {}\n",
+		"cmd/main.go":   "package main\n",
+		"cmd/stripe.go": "package main\n\n// zebra stripes\n",
+	}
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(filepath.Join(root, "cmd"))
+
+	tests := []struct {
+		name     string
+		files    []string
+		expected []string
+	}{
+		{"Whole project", nil, []string{"stripe.go", "../lib/zebra.go"}},
+		{"Already included", []string{"./stripe.go"}, []string{"./stripe.go", "../lib/zebra.go"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Context{Files: tt.files, AutoBudget: 1000}
+			if err := c.addRelevant("zebra"); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(c.Files, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, c.Files)
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(root, ".jenai", "index", "lexical.json")); err != nil {
+		t.Errorf("Expected the index at the root of the project: %v", err)
+	}
+	if _, err := os.Stat(".jenai"); err == nil {
+		t.Errorf("Expected no index in the current directory")
+	}
+}
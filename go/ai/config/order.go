@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// PathInfo describes an included path.
+type PathInfo struct {
+	Path string `yaml:"path"`
+	// Size and Hash are the size in bytes and the SHA-256 of the content read, before extraction.
+	Size int64  `yaml:"size"`
+	Hash string `yaml:"sha256"`
+}
+
+// Orders are the strategies ordering the files of the context:
+//   - given keeps the --file arguments first and then the files of each --dir, in order,
+//   - alpha sorts by path,
+//   - dir groups the files by directory,
+//   - mtime puts the most recently modified files last, closest to the instructions.
+var Orders = []string{"given", "alpha", "dir", "mtime"}
+
+// CheckOrder returns an error if the order is unknown.
+func CheckOrder(order string) error {
+	if order != "" && !slices.Contains(Orders, order) {
+		return fmt.Errorf("unknown order %q, expected one of %s", order, strings.Join(Orders, ", "))
+	}
+
+	return nil
+}
+
+// orderedPaths returns the paths of the context without duplicates, in the order of the context.
+// Paths are compared once made absolute and resolved from symbolic links, the first occurrence of
+// a path is kept.
+func (c *Context) orderedPaths() ([]string, error) {
+	var res []string
+	seen := map[string]bool{}
+	for path, err := range c.allPaths {
+		if err != nil {
+			return nil, err
+		}
+
+		key, err := canonical(path)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[key] {
+			seen[key] = true
+			res = append(res, path)
+		}
+	}
+
+	if err := CheckOrder(c.Order); err != nil {
+		return nil, err
+	}
+
+	switch c.Order {
+	case "alpha":
+		sort.SliceStable(res, func(i, j int) bool { return res[i] < res[j] })
+
+	case "dir":
+		sort.SliceStable(res, func(i, j int) bool {
+			di, dj := filepath.Dir(parseScope(res[i]).path), filepath.Dir(parseScope(res[j]).path)
+			if di != dj {
+				return di < dj
+			}
+			return res[i] < res[j]
+		})
+
+	case "mtime":
+		mtimes := map[string]int64{}
+		for _, path := range res {
+			// URLs and missing files come first, the error is reported when they are read.
+			if info, err := os.Stat(parseScope(path).path); err == nil {
+				mtimes[path] = info.ModTime().UnixNano()
+			}
+		}
+		sort.SliceStable(res, func(i, j int) bool { return mtimes[res[i]] < mtimes[res[j]] })
+	}
+
+	return res, nil
+}
+
+// canonical returns the absolute path of a file with its symbolic links resolved, followed by the
+// scope of the specification if any.
+// URLs and missing files are returned as is.
+func canonical(spec string) (string, error) {
+	if isURL(spec) {
+		return spec, nil
+	}
+
+	path := parseScope(spec).path
+	scope := strings.TrimPrefix(spec, path)
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+
+	return abs + scope, nil
+}
@@ -0,0 +1,72 @@
+//nolint:revive
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOrderedPaths(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	for i, name := range []string{"b/z.txt", "a.txt", "b/c/y.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// The first file is the most recent.
+		mtime := now.Add(-time.Duration(i) * time.Hour)
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := filepath.Join(dir, "link.txt")
+	if err := os.Symlink(filepath.Join(dir, "a.txt"), link); err != nil {
+		t.Fatal(err)
+	}
+
+	p := func(name string) string { return filepath.Join(dir, name) }
+	tests := []struct {
+		order    string
+		expected []string
+	}{
+		{"given", []string{p("b/z.txt"), p("a.txt"), p("b/c/y.txt")}},
+		{"alpha", []string{p("a.txt"), p("b/c/y.txt"), p("b/z.txt")}},
+		{"dir", []string{p("a.txt"), p("b/z.txt"), p("b/c/y.txt")}},
+		{"mtime", []string{p("b/c/y.txt"), p("a.txt"), p("b/z.txt")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			// The symbolic link and the files of the directory are duplicates.
+			ctx := Context{
+				Files: []string{p("b/z.txt"), p("a.txt"), link},
+				Dirs:  []string{p("b")},
+				Order: tt.order,
+			}
+			got, err := ctx.orderedPaths()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	_, paths, err := (&Context{Files: []string{p("a.txt"), link}}).Build()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []PathInfo{{p("a.txt"), 5,
+		"18b7cb099a9ea3f50ba899b5ba81e0d377a5f3b16f8f6eeb8b3e58cd4692b993"}}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, paths)
+	}
+}
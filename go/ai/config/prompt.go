@@ -1,19 +1,119 @@
 package config
 
-import "strings"
+import (
+	"slices"
+	"strings"
+
+	"github.com/mooss/jen/go/ai/errs"
+	"github.com/mooss/jen/go/ai/prompts"
+)
+
+// Options are the sources a prompt is built from.
+type Options struct {
+	// Name is the name of the library prompt, empty when there is none.
+	Name string
+
+	// Args are the positional arguments, consumed by the named prompt or appended to it.
+	Args []string
+
+	// Clipboard is the content read from the clipboard.
+	Clipboard string
+
+	// Stdin is the content from the standard input.
+	Stdin string
+
+	// Context describes the files and directories to include.
+	Context Context
+}
+
+// Build evaluates the named prompt and assembles it with the other sources.
+func (opts Options) Build(lib prompts.Library) (Prompt, error) {
+	var primary string
+	positional := opts.Args
+
+	if opts.Name != "" {
+		positional = slices.Clone(opts.Args)
+		var err error
+		primary, err = prompts.NewEvalContext(lib, &positional).Evaluate(opts.Name)
+		if err != nil {
+			return Prompt{}, errs.PromptErr(err)
+		}
+	}
+
+	if opts.Context.Auto {
+		if err := opts.Context.addRelevant(opts.query(primary)); err != nil {
+			return Prompt{}, errs.ContextErr(err)
+		}
+	}
+
+	if opts.Context.RAG > 0 {
+		if err := opts.Context.retrieve(opts.query(primary)); err != nil {
+			return Prompt{}, errs.ContextErr(err)
+		}
+	}
+
+	if err := opts.Context.checkImages(); err != nil {
+		return Prompt{}, errs.ContextErr(err)
+	}
+
+	context, paths, err := opts.Context.Build()
+	if err != nil {
+		return Prompt{}, errs.ContextErr(err)
+	}
+	renderer, err := RendererFor(opts.Context.Format)
+	if err != nil {
+		return Prompt{}, errs.InputErr(err)
+	}
+
+	res := Prompt{
+		Args:         opts.Args,
+		Attachments:  opts.Context.Images,
+		Clipboard:    opts.Clipboard,
+		Context:      context,
+		Boundary:     renderer.Boundary(),
+		ContextAbove: opts.Context.Above,
+		Paths:        paths,
+		Positional:   strings.Join(positional, " "),
+		Name:         opts.Name,
+		Primary:      primary,
+		Stdin:        opts.Stdin,
+	}
+
+	return res, nil
+}
+
+// query returns the text used to rank the repository files: the text of the user, or the named
+// prompt when there is none.
+func (opts Options) query(primary string) string {
+	query := strings.Join(append(slices.Clone(opts.Args), opts.Clipboard, opts.Stdin), " ")
+	if strings.TrimSpace(query) == "" {
+		return primary
+	}
+
+	return query
+}
 
 type Prompt struct {
+	// Name is the name of the library prompt, empty when there is none.
+	Name string
+
+	// Args are the positional arguments given to the named prompt.
+	Args []string
+
 	// Context is the content of the included paths.
 	Context string
 
+	// Boundary starts each section of the context, see Renderer.
+	Boundary string
+
 	// ContextAbove is true when the context files should be included at the top of the prompt.
 	ContextAbove bool
 
 	// Clipboard is the content read from the clipboard.
 	Clipboard string
 
-	// Paths is the names of the included paths.
-	Paths []string
+	// Paths describes the included paths.
+	Paths []PathInfo
 
 	// Positional is the joined positional arguments.
 	Positional string
@@ -23,6 +123,12 @@ type Prompt struct {
 
 	// Stdin is the content from the standard input.
 	Stdin string
+
+	// Extra are instructions appended by jenai itself, for instance to request a patch.
+	Extra []string
+
+	// Attachments are the images sent along with the prompt, as paths or URLs.
+	Attachments []string
 }
 
 // Empty returns true when the prompt is empty (the context does not count here).
@@ -53,7 +159,7 @@ func (p Prompt) static() []string {
 		buf = append(buf, p.Stdin)
 	}
 
-	return buf
+	return append(buf, p.Extra...)
 }
 
 // Static returns the static part of the prompt (without the context).
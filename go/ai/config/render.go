@@ -0,0 +1,181 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Section is a piece of context, such as a file or a range of lines.
+type Section struct {
+	// Name designates the section in the prompt.
+	Name string
+	// Path is the file the content comes from, empty when it was generated.
+	Path    string
+	Content string
+}
+
+// Renderer frames the sections of the context.
+type Renderer interface {
+	Render(sections []Section) string
+	// Boundary is the text starting each section of the rendered context, so that it can be cut
+	// between sections.
+	Boundary() string
+}
+
+// contextHeader introduces the context in every format.
+const contextHeader = "# Additional context (files)"
+
+// Renderers are the context formats, by name.
+var Renderers = map[string]Renderer{
+	"framed":   Framed{},
+	"json":     JSON{},
+	"markdown": Markdown{},
+	"xml":      XML{},
+}
+
+// DefaultContextFormat is the format used when neither the CLI nor the model select one.
+const DefaultContextFormat = "framed"
+
+// RendererFor returns the renderer of a context format, the default one when format is empty.
+func RendererFor(format string) (Renderer, error) {
+	if format == "" {
+		format = DefaultContextFormat
+	}
+
+	renderer, exists := Renderers[format]
+	if !exists {
+		return nil, fmt.Errorf("unknown context format %q, expected one of %s",
+			format, strings.Join(slices.Sorted(maps.Keys(Renderers)), ", "))
+	}
+
+	return renderer, nil
+}
+
+// Framed delimits the sections with ====> START OF and ====> END OF markers.
+type Framed struct{}
+
+func (Framed) Boundary() string { return "\n\n====> START OF " }
+
+func (Framed) Render(sections []Section) string {
+	var buf strings.Builder
+	buf.WriteString(contextHeader)
+	for _, section := range sections {
+		buf.WriteString("\n\n====> START OF " + section.Name + " <====\n\n")
+		buf.WriteString(section.Content)
+		buf.WriteString("\n\n====> END OF " + section.Name + " <====")
+	}
+
+	return buf.String()
+}
+
+// XML puts the sections in <file path="..."> tags.
+// Only the markup characters of the content are escaped, so that a file cannot close its tag and
+// inject other sections while quotes stay readable.
+type XML struct{}
+
+func (XML) Boundary() string { return "\n\n<file path=\"" }
+
+func (XML) Render(sections []Section) string {
+	var buf strings.Builder
+	buf.WriteString(contextHeader)
+	for _, section := range sections {
+		fmt.Fprintf(&buf, "\n\n<file path=\"%s\">\n%s\n</file>",
+			html.EscapeString(section.Name),
+			xmlEscaper.Replace(strings.TrimSuffix(section.Content, "\n")))
+	}
+
+	return buf.String()
+}
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// Markdown puts the sections in fenced code blocks, with a language inferred from the extension.
+type Markdown struct{}
+
+func (Markdown) Boundary() string { return "\n\n## " }
+
+func (Markdown) Render(sections []Section) string {
+	var buf strings.Builder
+	buf.WriteString(contextHeader)
+	for _, section := range sections {
+		content := strings.TrimSuffix(section.Content, "\n")
+		fence := fenceFor(content)
+		fmt.Fprintf(&buf, "\n\n## %s\n\n%s%s\n%s\n%s",
+			section.Name, fence, language(section.Path), content, fence)
+	}
+
+	return buf.String()
+}
+
+// JSON lists the sections in an array of objects with a path and a content.
+type JSON struct{}
+
+// Boundary is the start of the objects of the indented array, whose strings hold no newline.
+func (JSON) Boundary() string { return "\n  {\n    \"path\": " }
+
+func (JSON) Render(sections []Section) string {
+	type entry struct {
+		Path    string `json:"path"`
+		Content string `json:"content"`
+	}
+
+	entries := make([]entry, len(sections))
+	for i, section := range sections {
+		entries[i] = entry{section.Name, section.Content}
+	}
+
+	var buf strings.Builder
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false) // Code is full of < and &.
+	encoder.SetIndent("", "  ")
+	// Strings cannot fail to be encoded, nor can a strings.Builder fail to be written to.
+	_ = encoder.Encode(entries)
+
+	return contextHeader + "\n\n" + strings.TrimSuffix(buf.String(), "\n")
+}
+
+///////////////////////
+// Utility functions //
+
+// languages are the Markdown languages of the extensions whose name differs from the language.
+var languages = map[string]string{
+	".cc": "cpp", ".el": "elisp", ".h": "c", ".hpp": "cpp", ".js": "javascript", ".md": "markdown",
+	".mjs": "javascript", ".py": "python", ".rb": "ruby", ".rs": "rust", ".sh": "bash",
+	".ts": "typescript", ".yml": "yaml",
+}
+
+// language returns the Markdown language of a file, empty when unknown.
+func language(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	if lang, exists := languages[ext]; exists {
+		return lang
+	}
+
+	// Many extensions are language names, for instance .java, .json or .yaml.
+	lang := strings.TrimPrefix(ext, ".")
+	if lang == "" || strings.ContainsFunc(lang, func(r rune) bool { return r < 'a' || r > 'z' }) {
+		return ""
+	}
+
+	return lang
+}
+
+// fenceFor returns a fence longer than the backtick runs of the content.
+func fenceFor(content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+
+	return strings.Repeat("`", max(3, longest+1))
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// scope is the part of a file included as context: a range of lines, a Go declaration or the whole
+// file.
+type scope struct {
+	path string
+	// ranged is true when the scope is the range of lines from start to end.
+	ranged     bool
+	start, end int
+	// symbol is the name of a Go declaration, for instance Parse or Client.Send.
+	symbol string
+}
+
+var (
+	lineRange = regexp.MustCompile(`^(.+):(\d+)-(\d+)$`)
+	symbolRef = regexp.MustCompile(`^(.+)#([\pL_][\pL\pN_]*(?:\.[\pL_][\pL\pN_]*)?)$`)
+)
+
+// parseScope parses path:START-END and path#Symbol specifications.
+// Existing files and URLs are taken as is, even when they look like a specification.
+func parseScope(spec string) scope {
+	if isURL(spec) {
+		return scope{path: spec}
+	}
+	if _, err := os.Stat(spec); err == nil {
+		return scope{path: spec}
+	}
+
+	if match := lineRange.FindStringSubmatch(spec); match != nil {
+		start, _ := strconv.Atoi(match[2])
+		end, _ := strconv.Atoi(match[3])
+		return scope{path: match[1], ranged: true, start: start, end: end}
+	}
+
+	if match := symbolRef.FindStringSubmatch(spec); match != nil {
+		return scope{path: match[1], symbol: match[2]}
+	}
+
+	return scope{path: spec}
+}
+
+// apply returns the lines of the text in the scope and the number of the first one.
+func (s scope) apply(text string) (string, int, error) {
+	start, end := s.start, s.end
+	switch {
+	case s.symbol != "":
+		var err error
+		if start, end, err = declarationLines(s.path, text, s.symbol); err != nil {
+			return "", 0, err
+		}
+	case !s.ranged:
+		return text, 1, nil
+	}
+
+	lines := strings.SplitAfter(strings.TrimSuffix(text, "\n"), "\n")
+	if start < 1 || start > end || start > len(lines) {
+		return "", 0, fmt.Errorf("invalid line range %d-%d for %s (%d lines)",
+			s.start, s.end, s.path, len(lines))
+	}
+
+	return strings.Join(lines[start-1:min(end, len(lines))], ""), start, nil
+}
+
+// declarationLines returns the first and last lines of a Go declaration, including its doc comment.
+// Methods are designated by Type.Method.
+func declarationLines(path, source, symbol string) (int, int, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, path, source, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	lines := func(node ast.Node, doc *ast.CommentGroup) (int, int, error) {
+		start := node.Pos()
+		if doc != nil {
+			start = doc.Pos()
+		}
+		return fset.Position(start).Line, fset.Position(node.End()).Line, nil
+	}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if funcName(decl) == symbol {
+				return lines(decl, decl.Doc)
+			}
+
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				if !declares(spec, symbol) {
+					continue
+				}
+				if len(decl.Specs) == 1 { // The doc comment belongs to the declaration.
+					return lines(decl, decl.Doc)
+				}
+				return lines(spec, specDoc(spec))
+			}
+		}
+	}
+
+	return 0, 0, fmt.Errorf("no declaration of %s in %s", symbol, path)
+}
+
+// funcName returns the name of a function, prefixed by the receiver type for methods.
+func funcName(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return decl.Name.Name
+	}
+
+	recv := decl.Recv.List[0].Type
+	for {
+		switch expr := recv.(type) {
+		case *ast.StarExpr:
+			recv = expr.X
+			continue
+		case *ast.IndexExpr: // Generic receiver.
+			recv = expr.X
+			continue
+		case *ast.IndexListExpr:
+			recv = expr.X
+			continue
+		case *ast.Ident:
+			return expr.Name + "." + decl.Name.Name
+		}
+
+		return decl.Name.Name
+	}
+}
+
+// declares returns true when the type, variable or constant specification declares the symbol.
+func declares(spec ast.Spec, symbol string) bool {
+	switch spec := spec.(type) {
+	case *ast.TypeSpec:
+		return spec.Name.Name == symbol
+	case *ast.ValueSpec:
+		for _, name := range spec.Names {
+			if name.Name == symbol {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func specDoc(spec ast.Spec) *ast.CommentGroup {
+	switch spec := spec.(type) {
+	case *ast.TypeSpec:
+		return spec.Doc
+	case *ast.ValueSpec:
+		return spec.Doc
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+//nolint:revive
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileScope(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	source := `package main
+
+// Client sends requests.
+type Client struct{}
+
+// Send sends a request.
+func (c *Client) Send() {}
+
+const (
+	// Answer is the answer.
+	Answer = 42
+	Other  = 0
+)
+
+func main() {
+	new(Client).Send()
+}
+`
+	if err := os.WriteFile(path, []byte(source), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		spec     string
+		expected string
+	}{
+		{"Range", path + ":1-2", "1: package main\n2: \n"},
+		{"Range clipped", path + ":16-99", "16: \tnew(Client).Send()\n17: }\n"},
+		{"Function", path + "#main", "15: func main() {\n16: \tnew(Client).Send()\n17: }\n"},
+		{"Method", path + "#Client.Send", "6: // Send sends a request.\n7: func (c *Client) Send() {}\n"},
+		{"Type", path + "#Client", "3: // Client sends requests.\n4: type Client struct{}\n"},
+		{"Grouped constant", path + "#Answer", "10: \t// Answer is the answer.\n11: \tAnswer = 42\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			section, _, err := fileSection(tt.spec, true)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if section.Content != tt.expected || section.Name != tt.spec || section.Path != path {
+				t.Errorf("Expected %q from %s, got %+v", tt.expected, path, section)
+			}
+		})
+	}
+
+	for _, spec := range []string{path + ":0-3", path + ":5-4", path + ":40-41", path + "#Missing"} {
+		if _, _, err := fileSection(spec, false); err == nil {
+			t.Errorf("Expected an error for %s", spec)
+		}
+	}
+}
@@ -3,6 +3,8 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
@@ -11,7 +13,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/mooss/jen/go/ai/errs"
 	"github.com/mooss/jen/go/utils"
+	"gopkg.in/yaml.v3"
 )
 
 //////////////////////
@@ -26,6 +30,17 @@ type SessionMetadata struct {
 	Requested bool
 }
 
+// NewSession returns the metadata of the session with the given name, ready to use.
+// An empty name creates a new session and "/last" selects the most recent one.
+func NewSession(name string) (SessionMetadata, error) {
+	res := SessionMetadata{Name: name}
+	if err := res.prepare(); err != nil {
+		return SessionMetadata{}, errs.ConfigErr(err)
+	}
+
+	return res, nil
+}
+
 // prepare sets the proper the session name and dir and ensures the session is valid and ready to
 // use.
 func (ses *SessionMetadata) prepare() error {
@@ -67,8 +82,8 @@ type Conversation struct {
 
 // Message represents a single message in the session.
 type Message struct {
-	Role    string `yaml:"role"`
-	Content string `yaml:"content"`
+	Role    string `json:"role" yaml:"role"`
+	Content string `json:"content" yaml:"content"`
 }
 
 // Load loads a conversation from a YAML file.
@@ -77,20 +92,103 @@ func (ses *SessionMetadata) Load() (Conversation, error) {
 	return utils.Wrapf(res, err, "failed to load session %s", ses.Path())
 }
 
+// Append records messages at the end of the session, as aichat would have.
+// The fields of the session file unknown to jenai are preserved.
+// Nothing is recorded when there is no session.
+func (ses *SessionMetadata) Append(model string, messages ...Message) (err error) {
+	if ses.Name == "" {
+		return nil
+	}
+	defer utils.Wrap(&err, "failed to append to session %s", ses.Path())
+
+	session := map[string]any{}
+	data, err := os.ReadFile(ses.Path())
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		session["model"] = model
+	case err != nil:
+		return err
+	default:
+		if err := yaml.Unmarshal(data, &session); err != nil {
+			return err
+		}
+	}
+
+	previous, _ := session["messages"].([]any)
+	for _, message := range messages {
+		previous = append(previous, map[string]any{"role": message.Role, "content": message.Content})
+	}
+	session["messages"] = previous
+
+	if data, err = yaml.Marshal(session); err != nil {
+		return err
+	}
+
+	return os.WriteFile(ses.Path(), data, 0644)
+}
+
+////////////////
+// Tool calls //
+
+// ToolCall is the record of a tool called by the model.
+type ToolCall struct {
+	Time      time.Time      `json:"time"`
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+	Output    string         `json:"output,omitempty"`
+	Error     string         `json:"error,omitempty"`
+}
+
+// ToolLogPath returns the path to the log of the tool calls made during the session.
+func (ses *SessionMetadata) ToolLogPath() string {
+	return filepath.Join(ses.Dir, ses.Name+".tools.jsonl")
+}
+
+// RecordToolCall appends a tool call to the log of the session.
+// Nothing is recorded when there is no session.
+func (ses *SessionMetadata) RecordToolCall(call ToolCall) (err error) {
+	if ses.Name == "" {
+		return nil
+	}
+	defer utils.Wrap(&err, "failed to record tool call in %s", ses.ToolLogPath())
+
+	data, err := json.Marshal(call)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(ses.ToolLogPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
 ///////////////////////
 // Utility functions //
 
-// sessionDir return the path to the session directory.
-func sessionDir() string {
-	root := "."
+// ProjectDir returns the path to the .jenai directory of the project.
+// In a git repo, it is at the root of the repo.
+func ProjectDir() string {
+	return filepath.Join(ProjectRoot(), ".jenai")
+}
 
-	// If in a git repo, the session is at the root of the repo.
+// ProjectRoot returns the root of the git repo, the current directory outside of a repo.
+func ProjectRoot() string {
 	gitRoot, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
-	if err == nil {
-		root = strings.TrimSpace(string(gitRoot))
+	if err != nil {
+		return "."
 	}
 
-	return filepath.Join(root, ".jenai", "aichat", "session")
+	return strings.TrimSpace(string(gitRoot))
+}
+
+// sessionDir return the path to the session directory.
+func sessionDir() string {
+	return filepath.Join(ProjectDir(), "aichat", "session")
 }
 
 // uniqueFilePrefix generates a unique file prefix based on a given directory, prefix, and suffix.
@@ -0,0 +1,257 @@
+// Package editor integrates jenai with editors through JSON-RPC over stdio, with LSP-style framing.
+//
+// The methods are:
+//   - prompts/list returns the names of the prompts.
+//   - prompts/render returns the prompt built from RunParams, without sending it.
+//   - prompts/run sends the prompt built from RunParams and returns the answer, which is also
+//     streamed with jenai/answer notifications.
+//   - jenai/codeActions returns a command running each prompt, for code action menus.
+//   - workspace/executeCommand executes such a command.
+package editor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/mooss/jen/go/ai/config"
+	"github.com/mooss/jen/go/ai/jenai"
+	"github.com/mooss/jen/go/ai/jsonrpc"
+	"github.com/mooss/jen/go/ai/models"
+	"github.com/mooss/jen/go/ai/prompts"
+)
+
+// RunCommand is the command executing a prompt, its single argument is RunParams.
+const RunCommand = "jenai.run"
+
+// RunParams describe a prompt invocation on an editor buffer.
+type RunParams struct {
+	// Prompt is the name of the prompt.
+	Prompt string `json:"prompt"`
+	// Args are the positional arguments of the prompt.
+	Args []string `json:"args,omitempty"`
+	// Text is the content of the buffer, given as input to the prompt.
+	Text string `json:"text,omitempty"`
+	// Range restricts the text to a range of lines.
+	Range *Range `json:"range,omitempty"`
+	// Files and Dirs are included as context.
+	Files []string `json:"files,omitempty"`
+	Dirs  []string `json:"dirs,omitempty"`
+	// LineNumbers prefixes the lines of the text and context files with their number.
+	LineNumbers bool `json:"line_numbers,omitempty"`
+	// Model overrides the default model.
+	Model string `json:"model,omitempty"`
+	// Session records the exchange in the given session, it is not recorded when empty.
+	Session string `json:"session,omitempty"`
+}
+
+// Range is a range of lines, 1-based and inclusive.
+type Range struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Command is an invocation proposed as a code action.
+type Command struct {
+	Title     string      `json:"title"`
+	Command   string      `json:"command"`
+	Arguments []RunParams `json:"arguments"`
+}
+
+// Result is the result of a prompt execution.
+type Result struct {
+	Content string `json:"content"`
+	Model   string `json:"model"`
+	Session string `json:"session,omitempty"`
+}
+
+// Server answers editor requests.
+type Server struct {
+	// Client is forked to answer each request.
+	Client *jenai.Client
+}
+
+// New returns a server for the given library, using model by default.
+func New(lib prompts.Library, model models.Spec) *Server {
+	return &Server{Client: jenai.New(lib, model, config.SessionMetadata{})}
+}
+
+// Serve answers the requests read from in until it is exhausted.
+func (srv *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	rpc := jsonrpc.NewServer()
+	rpc.Handle("initialize", srv.initialize)
+	rpc.Handle("shutdown", func(context.Context, *jsonrpc.Call) (any, error) { return nil, nil })
+	rpc.Handle("prompts/list", srv.list)
+	rpc.Handle("prompts/render", srv.render)
+	rpc.Handle("prompts/run", srv.run)
+	rpc.Handle("jenai/codeActions", srv.codeActions)
+	rpc.Handle("workspace/executeCommand", srv.executeCommand)
+
+	return rpc.Serve(ctx, jsonrpc.NewConn(in, out, jsonrpc.Headers{}))
+}
+
+//////////////
+// Handlers //
+
+func (*Server) initialize(context.Context, *jsonrpc.Call) (any, error) {
+	return map[string]any{
+		"serverInfo": map[string]string{"name": "jenai"},
+		"capabilities": map[string]any{
+			"executeCommandProvider": map[string]any{"commands": []string{RunCommand}},
+		},
+	}, nil
+}
+
+func (srv *Server) list(context.Context, *jsonrpc.Call) (any, error) {
+	return slices.Sorted(maps.Keys(srv.Client.Library.Prompts)), nil
+}
+
+func (srv *Server) render(_ context.Context, call *jsonrpc.Call) (any, error) {
+	var params RunParams
+	if err := call.Decode(&params); err != nil {
+		return nil, err
+	}
+
+	prompt, err := srv.build(params)
+	if err != nil {
+		return nil, err
+	}
+
+	return prompt.String(), nil
+}
+
+func (srv *Server) run(ctx context.Context, call *jsonrpc.Call) (any, error) {
+	var params RunParams
+	if err := call.Decode(&params); err != nil {
+		return nil, err
+	}
+
+	return srv.execute(ctx, call, params)
+}
+
+func (srv *Server) codeActions(context.Context, *jsonrpc.Call) (any, error) {
+	res := []Command{}
+	for _, name := range slices.Sorted(maps.Keys(srv.Client.Library.Prompts)) {
+		res = append(res, Command{
+			Title:     "jenai: " + name,
+			Command:   RunCommand,
+			Arguments: []RunParams{{Prompt: name}},
+		})
+	}
+
+	return res, nil
+}
+
+func (srv *Server) executeCommand(ctx context.Context, call *jsonrpc.Call) (any, error) {
+	var params struct {
+		Command   string      `json:"command"`
+		Arguments []RunParams `json:"arguments"`
+	}
+	if err := call.Decode(&params); err != nil {
+		return nil, err
+	}
+
+	if params.Command != RunCommand {
+		return nil, jsonrpc.Errorf(jsonrpc.InvalidParams, "unknown command: %s", params.Command)
+	}
+	if len(params.Arguments) != 1 {
+		return nil, jsonrpc.Errorf(jsonrpc.InvalidParams,
+			"%s expects exactly one argument, got %d", RunCommand, len(params.Arguments))
+	}
+
+	return srv.execute(ctx, call, params.Arguments[0])
+}
+
+///////////////////////
+// Utility functions //
+
+// execute runs the prompt and streams the answer as notifications.
+func (srv *Server) execute(ctx context.Context, call *jsonrpc.Call, params RunParams) (any, error) {
+	prompt, err := srv.build(params)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := srv.Client.Fork(params.Model, params.Session)
+	if err != nil {
+		return nil, err
+	}
+	client.Output = notifier{call}
+
+	reply, err := client.Ask(ctx, prompt)
+	if err != nil {
+		return nil, err
+	}
+
+	return Result{Content: reply.Content, Model: reply.Model, Session: reply.Session}, nil
+}
+
+func (srv *Server) build(params RunParams) (jenai.Prompt, error) {
+	if _, err := srv.Client.Library.RawPrompt(params.Prompt); err != nil {
+		return jenai.Prompt{}, jsonrpc.Errorf(jsonrpc.InvalidParams, "%s", err)
+	}
+
+	text, err := selection(params.Text, params.Range, params.LineNumbers)
+	if err != nil {
+		return jenai.Prompt{}, err
+	}
+
+	opts := jenai.Options{
+		Name:  params.Prompt,
+		Args:  params.Args,
+		Stdin: text,
+		Context: config.Context{
+			Files:       params.Files,
+			Dirs:        params.Dirs,
+			LineNumbers: params.LineNumbers,
+		},
+	}
+
+	return opts.Build(srv.Client.Library)
+}
+
+// selection returns the lines of text within the range (everything when it is nil), optionally
+// prefixed by their original line number.
+func selection(text string, rng *Range, linum bool) (string, error) {
+	if rng == nil && !linum {
+		return text, nil
+	}
+
+	lines := strings.Split(text, "\n")
+	start, end := 1, len(lines)
+	if rng != nil {
+		start, end = rng.Start, rng.End
+	}
+
+	if start < 1 || end < start || end > len(lines) {
+		return "", jsonrpc.Errorf(jsonrpc.InvalidParams,
+			"invalid range %d-%d for a text of %d lines", start, end, len(lines))
+	}
+
+	lines = lines[start-1 : end]
+	if linum {
+		for i := range lines {
+			lines[i] = fmt.Sprintf("%d: %s", start+i, lines[i])
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// notifier streams the answer of a request with jenai/answer notifications.
+type notifier struct{ call *jsonrpc.Call }
+
+func (nt notifier) Write(data []byte) (int, error) {
+	err := nt.call.Conn.Notify("jenai/answer", map[string]any{
+		"id":   nt.call.ID,
+		"text": string(data),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
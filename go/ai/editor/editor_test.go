@@ -0,0 +1,92 @@
+//nolint:revive
+package editor
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mooss/jen/go/ai/jenai"
+	"github.com/mooss/jen/go/ai/jsonrpc"
+	"github.com/mooss/jen/go/ai/models"
+	"github.com/mooss/jen/go/ai/prompts"
+)
+
+// chunked is a backend echoing the message it received, one line at a time.
+type chunked struct{}
+
+func (chunked) Send(_ context.Context, req jenai.Request, out io.Writer) (string, error) {
+	for _, line := range strings.SplitAfter(req.Message, "\n") {
+		if _, err := io.WriteString(out, line); err != nil {
+			return "", err
+		}
+	}
+
+	return req.Message, nil
+}
+
+func TestExecuteCommand(t *testing.T) {
+	lib := prompts.Library{Prompts: map[string]string{"review": "Review this:"}}
+	srv := New(lib, models.Spec{})
+	srv.Client.Backend = chunked{}
+
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+	go func() {
+		_ = srv.Serve(context.Background(), serverIn, serverOut)
+		serverOut.Close()
+	}()
+
+	client := jsonrpc.NewConn(clientIn, clientOut, jsonrpc.Headers{})
+	params := map[string]any{
+		"command": RunCommand,
+		"arguments": []RunParams{{
+			Prompt:      "review",
+			Text:        "a\nb\nc\nd",
+			Range:       &Range{Start: 2, End: 3},
+			LineNumbers: true,
+		}},
+	}
+	if err := client.Call(1, "workspace/executeCommand", params); err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+
+	expected := "Review this:\n\n2: b\n3: c"
+	var streamed strings.Builder
+	for {
+		msg, err := client.Read()
+		if err != nil {
+			t.Fatalf("Failed to read message: %v", err)
+		}
+
+		if msg.Method == "jenai/answer" {
+			var chunk struct{ Text string }
+			if err := json.Unmarshal(msg.Params, &chunk); err != nil {
+				t.Fatalf("Invalid notification %s: %v", msg.Params, err)
+			}
+			streamed.WriteString(chunk.Text)
+			continue
+		}
+
+		if msg.Error != nil {
+			t.Fatalf("Unexpected error: %v", msg.Error)
+		}
+
+		var res Result
+		if err := json.Unmarshal(msg.Result, &res); err != nil {
+			t.Fatalf("Invalid result %s: %v", msg.Result, err)
+		}
+		if res.Content != expected {
+			t.Errorf("Expected content %q, got %q", expected, res.Content)
+		}
+		break
+	}
+
+	if streamed.String() != expected {
+		t.Errorf("Expected streamed answer %q, got %q", expected, streamed.String())
+	}
+
+	clientOut.Close()
+}
@@ -0,0 +1,99 @@
+// Package errs classifies jenai's errors so that they can be reported with distinct exit codes.
+package errs
+
+import "errors"
+
+// Kind is the category of an error.
+type Kind int
+
+const (
+	// Internal is for errors that were not classified.
+	Internal Kind = iota
+	// Input is for invalid user input (flags, arguments, stdin, clipboard).
+	Input
+	// Config is for configuration errors (config dir, model zoo, prompt library, session).
+	Config
+	// Prompt is for prompt evaluation errors (unknown prompt, template failure).
+	Prompt
+	// Context is for context building errors (unreadable file, directory or URL).
+	Context
+	// Backend is for errors coming from the model backend.
+	Backend
+)
+
+// exitCodes maps each kind to its exit code.
+// 1 is kept for unclassified errors and 2 follows the convention for usage errors.
+var exitCodes = map[Kind]int{
+	Internal: 1,
+	Input:    2,
+	Config:   3,
+	Prompt:   4,
+	Context:  5,
+	Backend:  6,
+}
+
+var names = map[Kind]string{
+	Internal: "internal",
+	Input:    "input",
+	Config:   "config",
+	Prompt:   "prompt",
+	Context:  "context",
+	Backend:  "backend",
+}
+
+func (k Kind) String() string { return names[k] }
+
+// ExitCode returns the exit code associated with the kind.
+func (k Kind) ExitCode() int { return exitCodes[k] }
+
+// Error is an error tagged with its kind.
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+func (e *Error) Unwrap() error { return e.Err }
+
+// New tags err with the given kind.
+// Returns nil when err is nil, so that it can wrap a result directly.
+// An error that is already classified keeps its original kind.
+func New(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var classified *Error
+	if errors.As(err, &classified) {
+		return err
+	}
+
+	return &Error{Kind: kind, Err: err}
+}
+
+// Shortcuts for New.
+
+func InputErr(err error) error   { return New(Input, err) }
+func ConfigErr(err error) error  { return New(Config, err) }
+func PromptErr(err error) error  { return New(Prompt, err) }
+func ContextErr(err error) error { return New(Context, err) }
+func BackendErr(err error) error { return New(Backend, err) }
+
+// KindOf returns the kind of err, Internal if it was not classified.
+func KindOf(err error) Kind {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.Kind
+	}
+
+	return Internal
+}
+
+// ExitCode returns the exit code for err, 0 when err is nil.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+
+	return KindOf(err).ExitCode()
+}
@@ -0,0 +1,53 @@
+//nolint:revive
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestKind(t *testing.T) {
+	base := errors.New("failure")
+	tests := []struct {
+		name string
+		err  error
+		kind Kind
+		code int
+	}{
+		{"Nil", nil, Internal, 0},
+		{"Unclassified", base, Internal, 1},
+		{"Input", InputErr(base), Input, 2},
+		{"Config", ConfigErr(base), Config, 3},
+		{"Prompt", PromptErr(base), Prompt, 4},
+		{"Context", ContextErr(base), Context, 5},
+		{"Backend", BackendErr(base), Backend, 6},
+		{"Wrapped", fmt.Errorf("while running: %w", PromptErr(base)), Prompt, 4},
+		{"Reclassified", ConfigErr(fmt.Errorf("loading: %w", InputErr(base))), Input, 2},
+		{"Unclassified wrapper", fmt.Errorf("while running: %w", base), Internal, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if kind := KindOf(tt.err); kind != tt.kind {
+				t.Errorf("Expected kind %s, got %s", tt.kind, kind)
+			}
+			if code := ExitCode(tt.err); code != tt.code {
+				t.Errorf("Expected exit code %d, got %d", tt.code, code)
+			}
+			if tt.err != nil && !errors.Is(tt.err, base) {
+				t.Errorf("Expected %v to wrap the original error", tt.err)
+			}
+		})
+	}
+
+	if InputErr(nil) != nil {
+		t.Error("Expected nil to stay nil")
+	}
+	if err := InputErr(base); err.Error() != "failure" {
+		t.Errorf("Expected the message of the original error, got %q", err.Error())
+	}
+	if Backend.String() != "backend" || Internal.ExitCode() != 1 {
+		t.Errorf("Unexpected name or exit code for %d", Backend)
+	}
+}
@@ -0,0 +1,188 @@
+// Package extract converts documents included as context to plain text, so that a PDF or an office
+// document does not end up as binary garbage in the prompt.
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// Extractor converts a document format to plain text.
+type Extractor struct {
+	Name string
+	// Extensions are the lowercase file extensions of the format, with the leading dot.
+	Extensions []string
+	// Sniff recognizes the format from the content, when the extension is unknown.
+	Sniff func(data []byte) bool
+	// MaxSize is the size in bytes above which documents are not extracted.
+	MaxSize int
+	Extract func(data []byte) (string, error)
+}
+
+// MaxInflated is the size in bytes above which decompressed content is truncated, so that a small
+// compression bomb cannot exhaust the memory.
+var MaxInflated int64 = 64 << 20
+
+// errTruncated reports content truncated at MaxInflated bytes.
+var errTruncated = errors.New("decompressed content exceeds the limit")
+
+// Registry is the list of known extractors, tried in order when sniffing.
+var Registry = []*Extractor{
+	{"pdf", []string{".pdf"}, isPDF, 32 << 20, PDF},
+	{"docx", []string{".docx"}, zipWith("word/document.xml"), 16 << 20, DOCX},
+	{"odt", []string{".odt"}, zipWith("content.xml"), 16 << 20, ODT},
+	{"ipynb", []string{".ipynb"}, nil, 16 << 20, Notebook},
+	{"html", []string{".html", ".htm", ".xhtml"}, isHTML, 8 << 20, HTML},
+}
+
+// For returns the extractor of a document, or nil when it should be passed through unchanged.
+// The extension of the path takes precedence over the content, which is only sniffed when the
+// extension is missing or unknown: text files often start with something that looks like HTML.
+func For(name string, data []byte) *Extractor {
+	ext := strings.ToLower(path.Ext(name))
+	for _, extractor := range Registry {
+		for _, candidate := range extractor.Extensions {
+			if ext == candidate {
+				return extractor
+			}
+		}
+	}
+
+	if isText(ext) {
+		return nil
+	}
+
+	for _, extractor := range Registry {
+		if extractor.Sniff != nil && extractor.Sniff(data) {
+			return extractor
+		}
+	}
+
+	return nil
+}
+
+// Text returns the plain text of a document.
+// When the extraction fails, the text is replaced by a note explaining why.
+func Text(name string, data []byte) string {
+	extractor := For(name, data)
+	if extractor == nil {
+		return string(data)
+	}
+
+	if len(data) > extractor.MaxSize {
+		return fmt.Sprintf("[jenai: %s not extracted: %d bytes exceed the %d bytes limit of %s]",
+			name, len(data), extractor.MaxSize, extractor.Name)
+	}
+
+	text, err := extractor.Extract(data)
+	if errors.Is(err, errTruncated) && text != "" {
+		return fmt.Sprintf("%s\n[jenai: %s truncated: decompressed content exceeds %d bytes]",
+			text, name, MaxInflated)
+	}
+	if err != nil {
+		return fmt.Sprintf("[jenai: failed to extract text from %s as %s: %s]",
+			name, extractor.Name, err)
+	}
+
+	return text
+}
+
+//////////////
+// Sniffing //
+
+func isPDF(data []byte) bool { return bytes.HasPrefix(data, []byte("%PDF-")) }
+
+func isHTML(data []byte) bool {
+	return strings.HasPrefix(http.DetectContentType(data), "text/html")
+}
+
+// textExtensions are the extensions of the documentation, configuration and source files, which
+// are never sniffed.
+var textExtensions = map[string]bool{
+	".adoc": true, ".bash": true, ".c": true, ".cc": true, ".cfg": true, ".clj": true,
+	".cmake": true, ".conf": true, ".cpp": true, ".cs": true, ".css": true, ".csv": true,
+	".dart": true, ".diff": true, ".el": true, ".env": true, ".erl": true, ".ex": true,
+	".exs": true, ".go": true, ".gradle": true, ".graphql": true, ".h": true, ".hpp": true,
+	".hs": true, ".ini": true, ".java": true, ".jl": true, ".js": true, ".json": true,
+	".jsx": true, ".kt": true, ".lisp": true, ".log": true, ".lua": true, ".markdown": true,
+	".md": true, ".mk": true, ".ml": true, ".mod": true, ".nim": true, ".org": true,
+	".patch": true, ".pl": true, ".proto": true, ".py": true, ".r": true, ".rb": true, ".rs": true,
+	".rst": true, ".scala": true, ".scss": true, ".sh": true, ".sql": true, ".sum": true,
+	".svelte": true, ".swift": true, ".tex": true, ".toml": true, ".ts": true, ".tsv": true,
+	".tsx": true, ".txt": true, ".vue": true, ".xml": true, ".yaml": true, ".yml": true,
+	".zig": true, ".zsh": true,
+}
+
+// isText returns true when the extension is the one of a text file, which must be passed through.
+func isText(ext string) bool {
+	return textExtensions[ext] || strings.HasPrefix(mime.TypeByExtension(ext), "text/")
+}
+
+// zipWith recognizes zip archives containing the given file.
+func zipWith(file string) func([]byte) bool {
+	return func(data []byte) bool {
+		if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+			return false
+		}
+
+		_, err := readZip(data, file)
+		return err == nil
+	}
+}
+
+///////////////////////
+// Utility functions //
+
+// readZip returns the content of a file of a zip archive.
+func readZip(data []byte, name string) ([]byte, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := archive.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return readLimited(file)
+}
+
+// readLimited reads at most MaxInflated bytes, returning errTruncated along with the bytes read
+// when there is more.
+func readLimited(reader io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(reader, MaxInflated+1))
+	if int64(len(data)) > MaxInflated {
+		return data[:MaxInflated], fmt.Errorf("%w (%d bytes)", errTruncated, MaxInflated)
+	}
+
+	return data, err
+}
+
+// squeeze trims the lines and removes the consecutive blank lines of a text.
+func squeeze(text string) string {
+	var res []string
+	blank := true // Leading blank lines are removed.
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			if blank {
+				continue
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		res = append(res, line)
+	}
+
+	return strings.TrimRight(strings.Join(res, "\n"), "\n")
+}
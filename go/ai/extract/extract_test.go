@@ -0,0 +1,134 @@
+//nolint:revive
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func archive(t *testing.T, name, content string) []byte {
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+	file, err := writer.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Write([]byte(content)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func pdf(content string, deflate bool) []byte {
+	stream, filter := []byte(content), ""
+	if deflate {
+		var buf bytes.Buffer
+		writer := zlib.NewWriter(&buf)
+		writer.Write(stream)
+		writer.Close()
+		stream, filter = buf.Bytes(), " /Filter /FlateDecode"
+	}
+
+	return []byte(fmt.Sprintf("%%PDF-1.4\n1 0 obj\n<< /Type /Font /Subtype /Type1 >>\nendobj\n"+
+		"2 0 obj\n<< /Length %d%s >>\nstream\n%s\nendstream\nendobj\n%%%%EOF\n",
+		len(stream), filter, stream))
+}
+
+func TestText(t *testing.T) {
+	docx := archive(t, "word/document.xml", `<?xml version="1.0"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body>
+<w:p><w:r><w:t>Hello</w:t></w:r><w:r><w:tab/><w:t xml:space="preserve">world</w:t></w:r></w:p>
+<w:p><w:pPr><w:pStyle w:val="Title"/></w:pPr><w:r><w:t>Second</w:t></w:r></w:p>
+</w:body></w:document>`)
+	odt := archive(t, "content.xml", `<?xml version="1.0"?>
+<office:document-content xmlns:office="urn:office" xmlns:text="urn:text">
+<office:automatic-styles>ignored</office:automatic-styles><office:body><office:text>
+<text:h>Title</text:h><text:p>A<text:s/>paragraph<text:line-break/>broken</text:p>
+</office:text></office:body></office:document-content>`)
+	notebook := `{"metadata": {"kernelspec": {"language": "python"}}, "cells": [
+{"cell_type": "markdown", "source": ["# Analysis\n", "Intro"]},
+{"cell_type": "code", "source": "print(1)\n", "outputs": [{"text": "1"}]}]}`
+	html := `<!DOCTYPE html><html><head><title>T</title><style>p {}</style></head>
+<body><h1>Title</h1><p>Some   <b>bold</b>
+text &amp; more<br>next</p><script>alert(1)</script><ul><li>one<li>two</ul></body></html>`
+	content := "BT /F1 12 Tf 72 700 Td (Hello \\(PDF\\)) Tj 0 -14 Td [(Wor) -20 (ld) -500 (again)] TJ " +
+		"T* <43616665> Tj ET"
+
+	tests := []struct {
+		name     string
+		path     string
+		data     []byte
+		expected string
+	}{
+		{"Plain text", "notes.org", []byte("* Heading\n"), "* Heading\n"},
+		{"Markdown starting with HTML", "README.md",
+			[]byte("<p align=\"center\">\n  <img src=\"logo.png\">\n</p>\n\n# Title\n- list\n"),
+			"<p align=\"center\">\n  <img src=\"logo.png\">\n</p>\n\n# Title\n- list\n"},
+		{"Markdown starting with a comment", "doc.md",
+			[]byte("<!-- markdownlint-disable -->\n# Doc\n"), "<!-- markdownlint-disable -->\n# Doc\n"},
+		{"Source starting with a tag", "view.txt", []byte("<b>bold</b>"), "<b>bold</b>"},
+		{"DOCX", "report.docx", docx, "Hello\tworld\nSecond"},
+		{"ODT", "report.odt", odt, "Title\nA paragraph\nbroken"},
+		{"Notebook", "analysis.ipynb", []byte(notebook),
+			"# Analysis\nIntro\n\n```python\nprint(1)\n```"},
+		{"HTML", "page.html", []byte(html), "Title\nSome bold text & more\nnext\none\ntwo"},
+		{"HTML sniffed", "https://example.com/page", []byte(html),
+			"Title\nSome bold text & more\nnext\none\ntwo"},
+		{"PDF", "paper.pdf", pdf(content, false), "Hello (PDF)\nWorld again\nCafe"},
+		{"Deflated PDF", "download", pdf(content, true), "Hello (PDF)\nWorld again\nCafe"},
+		{"DOCX sniffed", "attachment", docx, "Hello\tworld\nSecond"},
+		{"Failure", "broken.docx", []byte("not a zip"),
+			"[jenai: failed to extract text from broken.docx as docx: zip: not a valid zip file]"},
+		{"Scanned PDF", "scan.pdf", pdf("q 1 0 0 1 0 0 cm /Im0 Do Q", false),
+			"[jenai: failed to extract text from scan.pdf as pdf: no text found, " +
+				"the document may be scanned or use unsupported fonts]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Text(tt.path, tt.data); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	limit := For("page.html", nil).MaxSize
+	if got := Text("page.html", make([]byte, limit+1)); !strings.Contains(got, "exceed") {
+		t.Errorf("Expected a note about the size limit, got %q", got)
+	}
+}
+
+func TestCompressionBomb(t *testing.T) {
+	defer func(limit int64) { MaxInflated = limit }(MaxInflated)
+	MaxInflated = 1 << 10
+
+	padding := strings.Repeat(" ", 4<<10)
+	tests := []struct {
+		name     string
+		path     string
+		data     []byte
+		expected string
+	}{
+		{"PDF", "bomb.pdf", pdf("BT (Hello) Tj ET"+padding, true),
+			"Hello\n[jenai: bomb.pdf truncated: decompressed content exceeds 1024 bytes]"},
+		{"DOCX", "bomb.docx", archive(t, "word/document.xml", "<w:document>"+padding),
+			"[jenai: failed to extract text from bomb.docx as docx: " +
+				"decompressed content exceeds the limit (1024 bytes)]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Text(tt.path, tt.data); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package extract
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+)
+
+// DOCX returns the paragraphs of a Word document.
+func DOCX(data []byte) (string, error) {
+	content, err := readZip(data, "word/document.xml")
+	if err != nil {
+		return "", err
+	}
+
+	return walkXML(content, false, func(buf *strings.Builder, elem string, start bool) {
+		switch {
+		case elem == "p" && !start:
+			buf.WriteString("\n")
+		case elem == "tab" && start:
+			buf.WriteString("\t")
+		case elem == "br" && start:
+			buf.WriteString("\n")
+		}
+	}, func(stack []string) bool { return stack[len(stack)-1] == "t" })
+}
+
+// ODT returns the paragraphs of an OpenDocument text.
+func ODT(data []byte) (string, error) {
+	content, err := readZip(data, "content.xml")
+	if err != nil {
+		return "", err
+	}
+
+	return walkXML(content, false, func(buf *strings.Builder, elem string, start bool) {
+		switch {
+		case (elem == "p" || elem == "h") && !start:
+			buf.WriteString("\n")
+		case elem == "s" && start:
+			buf.WriteString(" ")
+		case elem == "tab" && start:
+			buf.WriteString("\t")
+		case elem == "line-break" && start:
+			buf.WriteString("\n")
+		}
+	}, func(stack []string) bool { return slices.Contains(stack, "body") })
+}
+
+// blocks are the HTML elements rendered on their own lines.
+var blocks = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true, "br": true, "dd": true,
+	"div": true, "dl": true, "dt": true, "figcaption": true, "footer": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "header": true, "hr": true, "li": true,
+	"main": true, "nav": true, "ol": true, "p": true, "pre": true, "section": true, "table": true,
+	"tr": true, "ul": true,
+}
+
+// HTML returns the visible text of a page, without scripts and styles.
+func HTML(data []byte) (string, error) {
+	text, err := walkXML(data, true, func(buf *strings.Builder, elem string, _ bool) {
+		switch {
+		case blocks[elem]:
+			buf.WriteString("\n")
+		case elem == "td" || elem == "th":
+			buf.WriteString("\t")
+		}
+	}, func(stack []string) bool {
+		return !slices.ContainsFunc(stack, func(elem string) bool {
+			return elem == "script" || elem == "style" || elem == "head"
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Whitespace is not significant in HTML, lines are made of the blocks delimited above.
+	var lines []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// Notebook returns the cells of a Jupyter notebook without their outputs, code cells being fenced
+// with the language of the kernel.
+func Notebook(data []byte) (string, error) {
+	var notebook struct {
+		Metadata struct {
+			Kernel struct {
+				Language string `json:"language"`
+			} `json:"kernelspec"`
+			Language struct {
+				Name string `json:"name"`
+			} `json:"language_info"`
+		} `json:"metadata"`
+		Cells []struct {
+			Type   string          `json:"cell_type"`
+			Source json.RawMessage `json:"source"`
+		} `json:"cells"`
+	}
+	if err := json.Unmarshal(data, &notebook); err != nil {
+		return "", err
+	}
+	if notebook.Cells == nil {
+		return "", errors.New("no cells")
+	}
+
+	language := notebook.Metadata.Language.Name
+	if language == "" {
+		language = notebook.Metadata.Kernel.Language
+	}
+
+	var cells []string
+	for _, cell := range notebook.Cells {
+		// The source is either a string or a list of lines.
+		var source string
+		if err := json.Unmarshal(cell.Source, &source); err != nil {
+			var lines []string
+			if err := json.Unmarshal(cell.Source, &lines); err != nil {
+				return "", errors.New("invalid cell source")
+			}
+			source = strings.Join(lines, "")
+		}
+
+		source = strings.TrimRight(source, "\n")
+		if cell.Type == "code" {
+			source = "```" + language + "\n" + source + "\n```"
+		}
+		cells = append(cells, source)
+	}
+
+	return strings.Join(cells, "\n\n"), nil
+}
+
+///////////////////////
+// Utility functions //
+
+// walkXML returns the character data of a document, calling tag on the start and end of each
+// element to add separators.
+// Only the character data for which text accepts the stack of open elements is kept.
+// Lenient parsing is meant for HTML, where line breaks in the character data are not significant.
+func walkXML(
+	data []byte, lenient bool,
+	tag func(buf *strings.Builder, elem string, start bool), text func(stack []string) bool,
+) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	if lenient {
+		decoder.Strict = false
+		decoder.AutoClose = xml.HTMLAutoClose
+		decoder.Entity = xml.HTMLEntity
+	}
+
+	var buf strings.Builder
+	var stack []string
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			elem := strings.ToLower(token.Name.Local)
+			stack = append(stack, elem)
+			tag(&buf, elem, true)
+		case xml.EndElement:
+			elem := strings.ToLower(token.Name.Local)
+			// Lenient parsing can yield end elements without a start.
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			tag(&buf, elem, false)
+		case xml.CharData:
+			if len(stack) == 0 || !text(stack) {
+				continue
+			}
+			if lenient {
+				token = bytes.ReplaceAll(token, []byte("\n"), []byte(" "))
+			}
+			buf.Write(token)
+		}
+	}
+
+	return squeeze(buf.String()), nil
+}
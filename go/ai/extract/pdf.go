@@ -0,0 +1,285 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// streamStart matches the dictionary and the start of a PDF stream.
+var streamStart = regexp.MustCompile(`(?s)<<((?:[^<>]|<[^<]|>[^>]|<<[^<>]*>>)*)>>\s*stream\r?\n`)
+
+// PDF returns the text shown by the content streams of a PDF document.
+// This is a best-effort extraction covering the uncompressed and deflated streams of documents with
+// simple font encodings; scanned documents have no text to extract.
+func PDF(data []byte) (string, error) {
+	var (
+		buf       strings.Builder
+		inflated  int64 // The total size of the decompressed streams, limited to MaxInflated.
+		truncated bool
+	)
+	for _, match := range streamStart.FindAllSubmatchIndex(data, -1) {
+		dict := string(data[match[2]:match[3]])
+		start := match[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+
+		// Fonts, images and object streams are not content streams.
+		if strings.Contains(dict, "/Subtype") || strings.Contains(dict, "/Type") ||
+			strings.Contains(dict, "/Length1") {
+			continue
+		}
+
+		stream := data[start : start+end]
+		switch {
+		case strings.Contains(dict, "/FlateDecode"):
+			reader, err := zlib.NewReader(bytes.NewReader(stream))
+			if err != nil {
+				continue
+			}
+			// Errors are ignored to keep the text read before them, as the end of line before
+			// endstream is often counted in the stream.
+			stream, err = readLimited(reader)
+			inflated += int64(len(stream))
+			if errors.Is(err, errTruncated) || inflated > MaxInflated {
+				truncated = true
+			}
+		case strings.Contains(dict, "/Filter"):
+			continue
+		}
+
+		showText(&buf, stream)
+		if truncated {
+			break
+		}
+	}
+
+	text := squeeze(buf.String())
+	if truncated {
+		return text, errTruncated
+	}
+	if text == "" {
+		return "", errors.New("no text found, the document may be scanned or use unsupported fonts")
+	}
+
+	return text, nil
+}
+
+// showText writes the text shown by the operators of a content stream.
+func showText(buf *strings.Builder, content []byte) {
+	var operands []string
+	lex := &pdfLexer{data: content}
+
+	for token, kind := lex.next(); kind != eof; token, kind = lex.next() {
+		switch kind {
+		case text:
+			operands = append(operands, token)
+			continue
+		case spacing:
+			operands = append(operands, " ")
+			continue
+		case other:
+			continue
+		}
+
+		switch token {
+		case "Tj", "TJ":
+			buf.WriteString(strings.Join(operands, ""))
+		case "'", `"`:
+			buf.WriteString("\n" + strings.Join(operands, ""))
+		case "T*", "ET":
+			buf.WriteString("\n")
+		case "Td", "TD":
+			// Only vertical moves start a new line, the vertical offset being the last number.
+			if lex.lastNumber != 0 {
+				buf.WriteString("\n")
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+///////////////
+// PDF lexer //
+
+type tokenKind int
+
+const (
+	eof tokenKind = iota
+	operator
+	text
+	// spacing is a large negative kerning in a TJ array, standing for a space.
+	spacing
+	other
+)
+
+// pdfLexer splits a content stream in operators and operands, decoding the strings.
+type pdfLexer struct {
+	data []byte
+	pos  int
+	// lastNumber is the last number read.
+	lastNumber float64
+	// inArray is true between the brackets of an array.
+	inArray bool
+}
+
+func (l *pdfLexer) next() (string, tokenKind) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == '(':
+			return l.literal(), text
+		case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+			l.pos += 2
+			return "<<", other
+		case c == '<':
+			return l.hex(), text
+		case c == '>':
+			l.pos++
+			return ">", other
+		case c == '[' || c == ']':
+			l.inArray = c == '['
+			l.pos++
+			return string(c), other
+		default:
+			word := l.word()
+			if number, err := strconv.ParseFloat(word, 64); err == nil {
+				l.lastNumber = number
+				if l.inArray && number < -200 {
+					return word, spacing
+				}
+				return word, other
+			}
+			if strings.HasPrefix(word, "/") {
+				return word, other
+			}
+			return word, operator
+		}
+	}
+
+	return "", eof
+}
+
+// literal reads a literal string, such as (Hello \(world\)).
+func (l *pdfLexer) literal() string {
+	var buf []byte
+	depth := 0
+	for l.pos++; l.pos < len(l.data); l.pos++ {
+		c := l.data[l.pos]
+		switch {
+		case c == '(':
+			depth++
+		case c == ')' && depth == 0:
+			l.pos++
+			return latin1(buf)
+		case c == ')':
+			depth--
+		case c == '\\' && l.pos+1 < len(l.data):
+			l.pos++
+			c = l.escape()
+		}
+		buf = append(buf, c)
+	}
+
+	return latin1(buf)
+}
+
+// escape decodes the escape sequence at the current position of a literal string.
+func (l *pdfLexer) escape() byte {
+	c := l.data[l.pos]
+	switch c {
+	case 'n':
+		return '\n'
+	case 'r':
+		return '\r'
+	case 't':
+		return '\t'
+	case 'b':
+		return '\b'
+	case 'f':
+		return '\f'
+	}
+
+	if c < '0' || c > '7' {
+		return c
+	}
+
+	// Octal code of up to three digits.
+	value := 0
+	for i := 0; i < 3 && l.pos < len(l.data) && '0' <= l.data[l.pos] && l.data[l.pos] <= '7'; i++ {
+		value = value*8 + int(l.data[l.pos]-'0')
+		l.pos++
+	}
+	l.pos--
+
+	return byte(value)
+}
+
+// hex reads a hexadecimal string, such as <48656C6C6F>.
+func (l *pdfLexer) hex() string {
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+	if end < 0 {
+		end = len(l.data) - l.pos
+	}
+
+	digits := strings.Map(func(r rune) rune {
+		if isSpace(byte(r)) {
+			return -1
+		}
+		return r
+	}, string(l.data[l.pos+1:l.pos+end]))
+	l.pos += end + 1
+
+	if len(digits)%2 == 1 {
+		digits += "0"
+	}
+	var res []byte
+	for i := 0; i+1 < len(digits); i += 2 {
+		value, err := strconv.ParseUint(digits[i:i+2], 16, 8)
+		if err != nil {
+			return ""
+		}
+		res = append(res, byte(value))
+	}
+
+	return latin1(res)
+}
+
+// word reads a keyword, a number or a name.
+func (l *pdfLexer) word() string {
+	start := l.pos
+	for l.pos++; l.pos < len(l.data); l.pos++ {
+		c := l.data[l.pos]
+		if isSpace(c) || strings.IndexByte("()<>[]{}/%", c) >= 0 {
+			break
+		}
+	}
+
+	return string(l.data[start:l.pos])
+}
+
+// latin1 decodes the bytes of a string as Latin-1, which is close enough to the standard encodings
+// of PDF fonts.
+func latin1(data []byte) string {
+	runes := make([]rune, len(data))
+	for i, c := range data {
+		runes[i] = rune(c)
+	}
+
+	return string(runes)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
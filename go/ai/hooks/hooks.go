@@ -0,0 +1,183 @@
+// Package hooks installs the git hooks calling jenai.
+//
+// The hooks never block git: when jenai fails, they let the commit or the push proceed.
+// They are skipped when JENAI_SKIP_HOOKS is set to a non-empty value, and run the command found in
+// JENAI_COMMAND, or jenai by default.
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Marker identifies the hooks installed by jenai.
+const Marker = "# Installed by jenai hooks."
+
+// BackupSuffix is appended to the name of a foreign hook replaced with --force.
+const BackupSuffix = ".jenai-backup"
+
+// Hook is a git hook script.
+type Hook struct {
+	Name   string
+	Script string
+}
+
+// All are the hooks installed by jenai.
+var All = []Hook{
+	{"prepare-commit-msg", prepareCommitMsg},
+	{"pre-push", prePush},
+}
+
+// prepareCommitMsg prefills the message of plain commits, leaving messages given with -m, -F,
+// templates, merges and amends untouched.
+const prepareCommitMsg = `#!/bin/sh
+` + Marker + `
+# Prefills the commit message with jenai.
+[ -n "$JENAI_SKIP_HOOKS" ] && exit 0
+[ -n "$2" ] && exit 0
+
+# Do nothing if the message is already written, for instance when the hook runs twice.
+# The diff added by git commit -v below the scissors line is not part of the message.
+sed -n '/^# -\{24\} >8 -\{24\}$/q;p' "$1" 2>/dev/null | grep -v '^#' |
+	grep -q '[^[:space:]]' && exit 0
+
+message=$(${JENAI_COMMAND:-jenai} commit --print </dev/null) || exit 0
+[ -z "$message" ] && exit 0
+
+tmp="$1.jenai"
+{ printf '%s\n' "$message"; cat "$1"; } >"$tmp" && mv "$tmp" "$1"
+exit 0
+`
+
+// prePush prints a review of the commits about to be pushed.
+const prePush = `#!/bin/sh
+` + Marker + `
+# Prints a review of the outgoing commits with jenai.
+[ -n "$JENAI_SKIP_HOOKS" ] && exit 0
+
+zero=$(git hash-object --stdin </dev/null | tr '0-9a-f' '0')
+while read -r local_ref local_sha remote_ref remote_sha; do
+	[ "$local_sha" = "$zero" ] && continue # Deleted ref.
+
+	if [ "$remote_sha" = "$zero" ]; then # New ref, review the commits unknown to the remotes.
+		oldest=$(git rev-list "$local_sha" --not --remotes | tail -n 1)
+		[ -z "$oldest" ] && continue
+		base=$(git rev-parse --verify -q "$oldest^") || base=$(git hash-object -t tree /dev/null)
+	else
+		base=$remote_sha
+	fi
+
+	diff=$(git diff "$base" "$local_sha") || continue
+	[ -z "$diff" ] && continue
+
+	echo "jenai review of $local_ref -> $remote_ref:" >&2
+	printf '%s\n' "$diff" | ${JENAI_COMMAND:-jenai} diff_review >&2 || true
+	echo >&2
+done
+exit 0
+`
+
+// Dir returns the hooks directory of the repository of the working directory, honoring
+// core.hooksPath.
+func Dir(ctx context.Context) (string, error) {
+	output, err := exec.CommandContext(ctx, "git", "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return "", fmt.Errorf("not in a git repository: %w", err)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Install writes the hooks into dir.
+// Hooks previously installed by jenai are overwritten, foreign hooks are only replaced when force
+// is true, in which case they are backed up.
+// An existing backup is never overwritten.
+// Every hook is checked before any is written, so that a refusal leaves the directory untouched.
+func Install(dir string, force bool) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var foreign []string
+	for _, hook := range All {
+		path := filepath.Join(dir, hook.Name)
+		installed, err := ours(path)
+		switch {
+		case err != nil:
+			return err
+		case installed || !exists(path):
+			continue
+		case !force:
+			return fmt.Errorf("%s already exists and was not installed by jenai (use --force)",
+				path)
+		case exists(path + BackupSuffix):
+			return fmt.Errorf("%s would overwrite the backup of a previous hook, "+
+				"restore or remove it first", path+BackupSuffix)
+		}
+		foreign = append(foreign, path)
+	}
+
+	for _, path := range foreign {
+		if err := os.Rename(path, path+BackupSuffix); err != nil {
+			return err
+		}
+	}
+
+	for _, hook := range All {
+		if err := os.WriteFile(filepath.Join(dir, hook.Name), []byte(hook.Script), 0755); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Uninstall removes the hooks installed by jenai from dir, restoring the backed up hooks.
+func Uninstall(dir string) error {
+	for _, hook := range All {
+		path := filepath.Join(dir, hook.Name)
+		installed, err := ours(path)
+		if err != nil {
+			return err
+		}
+		if !installed {
+			continue
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+
+		if exists(path + BackupSuffix) {
+			if err := os.Rename(path+BackupSuffix, path); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ours returns true when the hook at path was installed by jenai.
+func ours(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return strings.Contains(string(data), Marker), nil
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,171 @@
+//nolint:revive
+package hooks
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestInstall(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "hooks")
+	for range 2 { // Installing twice must be harmless.
+		if err := Install(dir, false); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	for _, hook := range All {
+		path := filepath.Join(dir, hook.Name)
+		if got := read(t, path); got != hook.Script {
+			t.Errorf("Expected %s to contain the hook script, got %q", hook.Name, got)
+		}
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm()&0100 == 0 {
+			t.Errorf("Expected %s to be executable, got %v (%v)", hook.Name, info.Mode(), err)
+		}
+	}
+
+	if err := Uninstall(dir); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, hook := range All {
+		if exists(filepath.Join(dir, hook.Name)) {
+			t.Errorf("Expected %s to be removed", hook.Name)
+		}
+	}
+}
+
+func TestForeignHook(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pre-push")
+	foreign := "#!/bin/sh\necho mine\n"
+	if err := os.WriteFile(path, []byte(foreign), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Install(dir, false); err == nil {
+		t.Fatal("Expected an error when a foreign hook exists, got nil")
+	}
+	if got := read(t, path); got != foreign {
+		t.Errorf("Expected the foreign hook to be untouched, got %q", got)
+	}
+
+	if err := Install(dir, true); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := read(t, path+BackupSuffix); got != foreign {
+		t.Errorf("Expected the foreign hook to be backed up, got %q", got)
+	}
+
+	// Another foreign hook replacing ours cannot be forced over the backup.
+	other := "#!/bin/sh\necho other\n"
+	if err := os.WriteFile(path, []byte(other), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Install(dir, true); err == nil {
+		t.Fatal("Expected an error when the backup exists, got nil")
+	}
+	if read(t, path) != other || read(t, path+BackupSuffix) != foreign {
+		t.Error("Expected the hook and its backup to be untouched")
+	}
+	if err := os.WriteFile(path, []byte(prePush), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Uninstall(dir); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := read(t, path); got != foreign {
+		t.Errorf("Expected the foreign hook to be restored, got %q", got)
+	}
+	if exists(path + BackupSuffix) {
+		t.Error("Expected the backup to be removed")
+	}
+}
+
+func TestForceChecksEveryHook(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"prepare-commit-msg":      "#!/bin/sh\necho first\n",
+		"pre-push":                "#!/bin/sh\necho second\n",
+		"pre-push" + BackupSuffix: "#!/bin/sh\necho backup\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Install(dir, true); err == nil {
+		t.Fatal("Expected an error when a backup exists, got nil")
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(files) {
+		t.Errorf("Expected no file to be added, got %d entries", len(entries))
+	}
+	for name, content := range files {
+		if got := read(t, filepath.Join(dir, name)); got != content {
+			t.Errorf("Expected %s to be untouched, got %q", name, got)
+		}
+	}
+}
+
+func TestPrepareCommitMsg(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh is not available")
+	}
+
+	dir := t.TempDir()
+	hook := filepath.Join(dir, "prepare-commit-msg")
+	fake := filepath.Join(dir, "fake-jenai")
+	if err := os.WriteFile(hook, []byte(prepareCommitMsg), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fake, []byte("#!/bin/sh\necho 'feat: Generated'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	scissors := "# ------------------------ >8 ------------------------\n" +
+		"diff --git a/main.go b/main.go\n+added line\n"
+	tests := []struct {
+		name     string
+		message  string
+		expected string
+	}{
+		{"Empty", "\n# Comment\n", "feat: Generated\n\n# Comment\n"},
+		{"Verbose", "\n# Comment\n" + scissors, "feat: Generated\n\n# Comment\n" + scissors},
+		{"Written", "fix: Mine\n# Comment\n" + scissors, "fix: Mine\n# Comment\n" + scissors},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "COMMIT_EDITMSG")
+			if err := os.WriteFile(path, []byte(tt.message), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(sh, hook, path)
+			cmd.Env = append(os.Environ(), "JENAI_COMMAND="+fake, "JENAI_SKIP_HOOKS=")
+			if output, err := cmd.CombinedOutput(); err != nil {
+				t.Fatalf("Unexpected error: %v\n%s", err, output)
+			}
+			if got := read(t, path); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package index
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// BM25 parameters.
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Result is a file matching a query.
+type Result struct {
+	// Path is relative to the root of the index.
+	Path  string
+	Score float64
+}
+
+// Search returns the files matching the query, the most relevant first.
+func (idx *Index) Search(query string) []Result {
+	terms := unique(Tokenize(query))
+	if len(terms) == 0 || len(idx.Docs) == 0 {
+		return nil
+	}
+
+	total := 0
+	frequency := map[string]int{} // Number of documents containing each term.
+	for _, doc := range idx.Docs {
+		total += doc.Length
+		for _, term := range terms {
+			if doc.Terms[term] > 0 {
+				frequency[term]++
+			}
+		}
+	}
+	averageLength := float64(total) / float64(len(idx.Docs))
+
+	var res []Result
+	for path, doc := range idx.Docs {
+		score := 0.0
+		for _, term := range terms {
+			count := float64(doc.Terms[term])
+			if count == 0 {
+				continue
+			}
+
+			n := float64(frequency[term])
+			idf := math.Log(1 + (float64(len(idx.Docs))-n+0.5)/(n+0.5))
+			norm := k1 * (1 - b + b*float64(doc.Length)/averageLength)
+			score += idf * count * (k1 + 1) / (count + norm)
+		}
+
+		if score > 0 {
+			res = append(res, Result{Path: path, Score: score})
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Score != res[j].Score {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Path < res[j].Path
+	})
+
+	return res
+}
+
+// Select returns the paths of the best results whose files fit together in the token budget, at
+// four bytes per token.
+// Results too large for the remaining budget are skipped in favor of smaller ones.
+func (idx *Index) Select(results []Result, budget int) []string {
+	var res []string
+	remaining := int64(budget) * 4
+	for _, result := range results {
+		if size := idx.Docs[result.Path].Size; size <= remaining {
+			res = append(res, result.Path)
+			remaining -= size
+		}
+	}
+
+	return res
+}
+
+//////////////////
+// Tokenization //
+
+// Tokenize returns the terms of a text: its identifiers and words in lower case, along with the
+// parts of the identifiers in camelCase or snake_case.
+// Terms of a single character and numbers are ignored.
+func Tokenize(text string) []string {
+	var res []string
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+
+	for _, word := range words {
+		parts := splitIdentifier(word)
+		if len(parts) > 1 {
+			res = appendTerm(res, word)
+		}
+		for _, part := range parts {
+			res = appendTerm(res, part)
+		}
+	}
+
+	return res
+}
+
+// splitIdentifier splits an identifier on underscores and case changes.
+func splitIdentifier(word string) []string {
+	var res []string
+	for _, part := range strings.Split(word, "_") {
+		runes := []rune(part)
+		start := 0
+		for i := 1; i < len(runes); i++ {
+			lowerToUpper := unicode.IsLower(runes[i-1]) && unicode.IsUpper(runes[i])
+			// End of an acronym, as in HTTPServer.
+			acronymEnd := i+1 < len(runes) && unicode.IsUpper(runes[i-1]) &&
+				unicode.IsUpper(runes[i]) && unicode.IsLower(runes[i+1])
+			if lowerToUpper || acronymEnd {
+				res = append(res, string(runes[start:i]))
+				start = i
+			}
+		}
+		res = append(res, string(runes[start:]))
+	}
+
+	return res
+}
+
+func appendTerm(terms []string, term string) []string {
+	term = strings.ToLower(strings.Trim(term, "_"))
+	if len([]rune(term)) < 2 || strings.IndexFunc(term, unicode.IsLetter) < 0 {
+		return terms
+	}
+
+	return append(terms, term)
+}
+
+func unique(terms []string) []string {
+	seen := map[string]bool{}
+	var res []string
+	for _, term := range terms {
+		if !seen[term] {
+			seen[term] = true
+			res = append(res, term)
+		}
+	}
+
+	return res
+}
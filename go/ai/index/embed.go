@@ -0,0 +1,209 @@
+package index
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/mooss/jen/go/ai/secrets"
+)
+
+// Embedder converts texts to vectors, close when the texts are semantically close.
+type Embedder interface {
+	// Name identifies the embedder, vectors of different embedders cannot be compared.
+	Name() string
+	// Embed returns the vectors of the texts, in order.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// NewEmbedder returns the embedder described by name: "hash" for the built-in hashing embedder,
+// or the base URL of an OpenAI-compatible API, using the given model and key.
+func NewEmbedder(name, model, key string) (Embedder, error) {
+	if name == "hash" {
+		return Hashing{Dims: 512}, nil
+	}
+
+	if !strings.HasPrefix(name, "http://") && !strings.HasPrefix(name, "https://") {
+		return nil, fmt.Errorf("unknown embedder %q, expected hash or the URL of an API", name)
+	}
+
+	return &OpenAI{URL: strings.TrimSuffix(name, "/"), Model: model, Key: key}, nil
+}
+
+/////////////
+// Hashing //
+
+// Hashing is an offline embedder hashing the terms of the texts into a fixed number of dimensions.
+// It captures lexical rather than semantic similarity.
+type Hashing struct {
+	Dims int
+}
+
+func (h Hashing) Name() string { return fmt.Sprintf("hash:%d", h.Dims) }
+
+func (h Hashing) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	res := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, h.Dims)
+		for _, term := range Tokenize(text) {
+			hash := fnv.New32a()
+			hash.Write([]byte(term))
+			sum := hash.Sum32()
+
+			// The sign bit limits the bias introduced by collisions.
+			if sum&(1<<31) != 0 {
+				vector[int(sum%uint32(h.Dims))]--
+			} else {
+				vector[int(sum%uint32(h.Dims))]++
+			}
+		}
+		res[i] = normalize(vector)
+	}
+
+	return res, nil
+}
+
+////////////
+// OpenAI //
+
+// OpenAI is an embedder calling the /embeddings endpoint of an OpenAI-compatible API.
+type OpenAI struct {
+	// URL is the base URL of the API, for instance https://api.openai.com/v1.
+	URL   string
+	Model string
+	// Key is the bearer token, omitted when empty.
+	Key string
+	// Client defaults to http.DefaultClient.
+	Client *http.Client
+}
+
+// maxResponseSize is the size above which an embeddings response is rejected, a batch of chunks
+// embedded in 3072 dimensions takes about 4MiB.
+const maxResponseSize = 64 << 20
+
+func (o *OpenAI) Name() string { return o.URL + "#" + o.Model }
+
+func (o *OpenAI) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]any{"model": o.Model, "input": texts})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.URL+"/embeddings",
+		bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if o.Key != "" {
+		req.Header.Set("Authorization", "Bearer "+o.Key)
+	}
+
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embeddings request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("embeddings request failed with status %d: %s",
+			resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	var decoded struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embeddings response: %w", err)
+	}
+	if len(data) > maxResponseSize {
+		return nil, fmt.Errorf("invalid embeddings response: larger than %d bytes", maxResponseSize)
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("invalid embeddings response: %w", err)
+	}
+
+	res := make([][]float32, len(texts))
+	for _, data := range decoded.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("invalid embeddings response: unexpected index %d", data.Index)
+		}
+		res[data.Index] = normalize(data.Embedding)
+	}
+	for i, vector := range res {
+		if vector == nil {
+			return nil, fmt.Errorf("invalid embeddings response: missing vector %d", i)
+		}
+	}
+
+	return res, nil
+}
+
+//////////////
+// Screened //
+
+// Screened applies a secret policy to the texts before embedding them with another embedder, so
+// that the secrets of the repository are not sent to an embeddings API.
+type Screened struct {
+	Embedder Embedder
+	Secrets  secrets.Policy
+}
+
+func (s Screened) Name() string { return s.Embedder.Name() }
+
+func (s Screened) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	screened := make([]string, len(texts))
+	for i, text := range texts {
+		var err error
+		if screened[i], err = s.Secrets.Apply(text); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.Embedder.Embed(ctx, screened)
+}
+
+///////////////////////
+// Utility functions //
+
+// normalize scales the vector to a unit length, so that the dot product is the cosine similarity.
+func normalize(vector []float32) []float32 {
+	norm := 0.0
+	for _, x := range vector {
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 {
+		return vector
+	}
+
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+
+	return vector
+}
+
+func dot(a, b []float32) float64 {
+	res := 0.0
+	for i := range min(len(a), len(b)) {
+		res += float64(a[i]) * float64(b[i])
+	}
+
+	return res
+}
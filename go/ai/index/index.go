@@ -0,0 +1,206 @@
+// Package index maintains local indexes of the files of a repository, to select the content
+// relevant to a prompt: a lexical index ranking whole files and a store of embedded chunks.
+//
+// The indexes are cached under .jenai/index and refreshed incrementally: only the files whose
+// modification time or size changed are read again.
+package index
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Dir is the directory of the index, relative to the root of the repository.
+const Dir = ".jenai/index"
+
+// maxFileSize is the size above which files are not indexed.
+const maxFileSize = 512 * 1024
+
+// Index is the lexical index of the files under a root directory.
+type Index struct {
+	// Root is the indexed directory.
+	Root string `json:"-"`
+	// Docs are the indexed files, by path relative to the root.
+	Docs map[string]*Doc `json:"docs"`
+}
+
+// Doc is an indexed file.
+type Doc struct {
+	ModTime int64 `json:"mtime"`
+	Size    int64 `json:"size"`
+	// Length is the number of terms of the file.
+	Length int `json:"length"`
+	// Terms are the number of occurrences of the terms of the file.
+	Terms map[string]int `json:"terms"`
+}
+
+// Open loads the index of root from its cache and refreshes it, saving it when it changed.
+func Open(root string) (*Index, error) {
+	idx, err := Load(root)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := idx.Refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	if changed {
+		return idx, idx.Save()
+	}
+
+	return idx, nil
+}
+
+// Load loads the index of root from its cache, returning an empty index when there is none.
+func Load(root string) (*Index, error) {
+	idx := &Index{Root: root, Docs: map[string]*Doc{}}
+
+	data, err := os.ReadFile(idx.path())
+	if errors.Is(err, fs.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, idx); err != nil || idx.Docs == nil {
+		// A corrupt cache is rebuilt rather than reported.
+		idx.Docs = map[string]*Doc{}
+	}
+
+	return idx, nil
+}
+
+// Save writes the index to its cache.
+func (idx *Index) Save() error {
+	if err := os.MkdirAll(filepath.Dir(idx.path()), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(idx.path(), data, 0644)
+}
+
+// Refresh indexes the new and modified files and forgets the deleted ones.
+// Returns true when the index changed.
+func (idx *Index) Refresh() (bool, error) {
+	changed := false
+	seen := map[string]bool{}
+
+	err := Walk(idx.Root, func(rel string, info fs.FileInfo) error {
+		seen[rel] = true
+		doc, exists := idx.Docs[rel]
+		if exists && doc.ModTime == info.ModTime().UnixNano() && doc.Size == info.Size() {
+			return nil
+		}
+
+		data, err := os.ReadFile(filepath.Join(idx.Root, rel))
+		if err != nil {
+			return err
+		}
+
+		changed = true
+		doc = &Doc{ModTime: info.ModTime().UnixNano(), Size: info.Size()}
+		idx.Docs[rel] = doc
+		if binary(data) { // Kept without terms, to avoid reading it again.
+			return nil
+		}
+
+		terms := Tokenize(string(data))
+		doc.Length, doc.Terms = len(terms), map[string]int{}
+		for _, term := range terms {
+			doc.Terms[term]++
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for rel := range idx.Docs {
+		if !seen[rel] {
+			delete(idx.Docs, rel)
+			changed = true
+		}
+	}
+
+	return changed, nil
+}
+
+func (idx *Index) path() string {
+	return filepath.Join(idx.Root, Dir, "lexical.json")
+}
+
+// Walk calls fn on the regular files under root that are worth indexing, with their path relative
+// to root.
+// Hidden directories, dependencies, files ignored by git and files larger than 512KiB are skipped.
+func Walk(root string, fn func(rel string, info fs.FileInfo) error) error {
+	known := gitFiles(root)
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		name := entry.Name()
+		if entry.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || name == "vendor" ||
+				name == "node_modules" || (known != nil && !known[rel])) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") ||
+			(known != nil && !known[rel]) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.Size() > maxFileSize {
+			return err
+		}
+
+		return fn(rel, info)
+	})
+}
+
+// gitFiles returns the set of the files under root that git does not ignore and of their
+// directories, by path relative to root, or nil when root is not in a git repository.
+func gitFiles(root string) map[string]bool {
+	output, err := exec.Command("git", "-C", root, "ls-files", "--cached", "--others",
+		"--exclude-standard", "-z").Output()
+	if err != nil {
+		return nil
+	}
+
+	res := map[string]bool{}
+	for _, rel := range strings.Split(string(output), "\x00") {
+		for rel = filepath.FromSlash(rel); rel != "" && rel != "."; rel = filepath.Dir(rel) {
+			res[rel] = true
+		}
+	}
+
+	return res
+}
+
+// binary returns true when the data looks like the content of a binary file.
+func binary(data []byte) bool {
+	return bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0
+}
@@ -0,0 +1,248 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// chunkLines is the maximum number of lines of a chunk.
+const chunkLines = 40
+
+// batchSize is the maximum number of chunks embedded at once.
+const batchSize = 64
+
+// Store holds the vectors of the chunks of the files under a root directory.
+type Store struct {
+	// Root is the indexed directory.
+	Root string `json:"-"`
+	// Embedder is the name of the embedder of the vectors.
+	Embedder string `json:"embedder"`
+	// Files are the indexed files, by path relative to the root.
+	Files map[string]*File `json:"files"`
+}
+
+// File is a file of the store.
+type File struct {
+	ModTime int64    `json:"mtime"`
+	Size    int64    `json:"size"`
+	Chunks  []*Chunk `json:"chunks"`
+}
+
+// Chunk is a range of lines of a file.
+type Chunk struct {
+	Path string `json:"-"`
+	// Start and End are the first and last lines of the chunk, starting from 1.
+	Start  int       `json:"start"`
+	End    int       `json:"end"`
+	Text   string    `json:"text"`
+	Vector []float32 `json:"vector"`
+}
+
+// Name returns the path and the range of lines of the chunk, for instance main.go:41-80.
+func (c *Chunk) Name() string { return fmt.Sprintf("%s:%d-%d", c.Path, c.Start, c.End) }
+
+// LoadStore loads the store of root from its cache, returning an empty store when there is none or
+// when it was built by another embedder.
+func LoadStore(root string, embedder Embedder) (*Store, error) {
+	store := &Store{Root: root, Embedder: embedder.Name(), Files: map[string]*File{}}
+
+	data, err := os.ReadFile(store.path())
+	if errors.Is(err, fs.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var cached Store
+	if err := json.Unmarshal(data, &cached); err == nil && cached.Files != nil &&
+		cached.Embedder == store.Embedder {
+		store.Files = cached.Files
+	}
+
+	for path, file := range store.Files {
+		for _, chunk := range file.Chunks {
+			chunk.Path = path
+		}
+	}
+
+	return store, nil
+}
+
+// OpenStore loads the store of root from its cache and refreshes it, saving it when it changed.
+func OpenStore(ctx context.Context, root string, embedder Embedder) (*Store, error) {
+	store, err := LoadStore(root, embedder)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := store.Refresh(ctx, embedder)
+	if err != nil {
+		return nil, err
+	}
+
+	if updated > 0 {
+		return store, store.Save()
+	}
+
+	return store, nil
+}
+
+// Save writes the store to its cache.
+func (s *Store) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path()), 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(s.path(), data, 0644)
+}
+
+// Refresh embeds the chunks of the new and modified files and forgets the deleted ones.
+// Returns the number of files embedded or forgotten.
+func (s *Store) Refresh(ctx context.Context, embedder Embedder) (int, error) {
+	var stale []string
+	forgotten := 0
+	seen := map[string]bool{}
+
+	err := Walk(s.Root, func(rel string, info fs.FileInfo) error {
+		seen[rel] = true
+		file, exists := s.Files[rel]
+		if !exists || file.ModTime != info.ModTime().UnixNano() || file.Size != info.Size() {
+			stale = append(stale, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for rel := range s.Files {
+		if !seen[rel] {
+			delete(s.Files, rel)
+			forgotten++
+		}
+	}
+
+	for _, rel := range stale {
+		if err := s.embed(ctx, embedder, rel); err != nil {
+			return 0, fmt.Errorf("failed to embed %s: %w", rel, err)
+		}
+	}
+
+	return len(stale) + forgotten, nil
+}
+
+// embed chunks and embeds a file.
+func (s *Store) embed(ctx context.Context, embedder Embedder, rel string) error {
+	path := filepath.Join(s.Root, rel)
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	file := &File{ModTime: info.ModTime().UnixNano(), Size: info.Size()}
+	if !binary(data) { // Binary files are kept without chunks, to avoid reading them again.
+		file.Chunks = chunkLinesOf(rel, string(data))
+	}
+
+	for start := 0; start < len(file.Chunks); start += batchSize {
+		batch := file.Chunks[start:min(start+batchSize, len(file.Chunks))]
+		texts := make([]string, len(batch))
+		for i, chunk := range batch {
+			texts[i] = chunk.Text
+		}
+
+		vectors, err := embedder.Embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		for i, chunk := range batch {
+			chunk.Vector = vectors[i]
+		}
+	}
+
+	s.Files[rel] = file
+	return nil
+}
+
+// Chunks returns the number of chunks of the store.
+func (s *Store) Chunks() int {
+	res := 0
+	for _, file := range s.Files {
+		res += len(file.Chunks)
+	}
+
+	return res
+}
+
+// Retrieve returns the k chunks closest to the query, the closest first.
+func (s *Store) Retrieve(ctx context.Context, embedder Embedder, query string, k int) (
+	[]*Chunk, error,
+) {
+	vectors, err := embedder.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+
+	type scored struct {
+		chunk *Chunk
+		score float64
+	}
+	var candidates []scored
+	for _, file := range s.Files {
+		for _, chunk := range file.Chunks {
+			candidates = append(candidates, scored{chunk, dot(vectors[0], chunk.Vector)})
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		return candidates[i].chunk.Name() < candidates[j].chunk.Name()
+	})
+
+	res := make([]*Chunk, 0, k)
+	for _, candidate := range candidates[:min(k, len(candidates))] {
+		res = append(res, candidate.chunk)
+	}
+
+	return res, nil
+}
+
+func (s *Store) path() string {
+	return filepath.Join(s.Root, Dir, "vectors.json")
+}
+
+// chunkLinesOf splits a text in chunks of chunkLines lines, ignoring the blank chunks.
+func chunkLinesOf(path, text string) []*Chunk {
+	var res []*Chunk
+	lines := strings.SplitAfter(strings.TrimSuffix(text, "\n"), "\n")
+	for start := 0; start < len(lines); start += chunkLines {
+		end := min(start+chunkLines, len(lines))
+		chunk := strings.Join(lines[start:end], "")
+		if strings.TrimSpace(chunk) == "" {
+			continue
+		}
+
+		res = append(res, &Chunk{Path: path, Start: start + 1, End: end, Text: chunk})
+	}
+
+	return res
+}
@@ -1,59 +1,102 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"maps"
+	"math"
+	"mime"
+	"net/http"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/mooss/bagend/go/flag"
+	"github.com/mooss/jen/go/ai/agent"
+	"github.com/mooss/jen/go/ai/cache"
+	"github.com/mooss/jen/go/ai/clipboard"
+	"github.com/mooss/jen/go/ai/codeblock"
+	"github.com/mooss/jen/go/ai/commit"
 	"github.com/mooss/jen/go/ai/config"
+	"github.com/mooss/jen/go/ai/editor"
+	"github.com/mooss/jen/go/ai/errs"
+	"github.com/mooss/jen/go/ai/hooks"
+	"github.com/mooss/jen/go/ai/index"
+	"github.com/mooss/jen/go/ai/jenai"
+	"github.com/mooss/jen/go/ai/mapreduce"
+	"github.com/mooss/jen/go/ai/mcp"
 	"github.com/mooss/jen/go/ai/models"
+	"github.com/mooss/jen/go/ai/patch"
 	"github.com/mooss/jen/go/ai/prompts"
-	"gopkg.in/yaml.v3"
+	"github.com/mooss/jen/go/ai/review"
+	"github.com/mooss/jen/go/ai/secrets"
+	"github.com/mooss/jen/go/ai/server"
+	"github.com/mooss/jen/go/ai/tools"
 )
 
 var home = os.Getenv("HOME")
 var configDir = filepath.Join(home, ".config", "jenai")
 
 func main() {
-	ensureConfig()
+	if err := execute(); err != nil {
+		fatal(err)
+	}
+}
+
+// execute runs jenai and returns the error that should determine the exit code.
+func execute() error {
+	if err := ensureConfig(); err != nil {
+		return errs.ConfigErr(err)
+	}
+
+	if len(os.Args) > 1 {
+		if command, exists := commands[os.Args[1]]; exists {
+			return command.run(os.Args[2:])
+		}
+	}
+
 	cfg, parser := conf()
 
 	if len(os.Args) == 1 { // No arguments, print help.
 		fmt.Print(parser.Help())
-		os.Exit(0)
+		fmt.Print(commandsHelp())
+		return nil
 	}
 
 	dumpConfig := false
 	parser.Bool("dump-config", &dumpConfig, "print the config and exit")
 
-	noerr0(cfg.ParseCLI(parser, os.Args[1:]))
+	if err := cfg.ParseCLI(parser, os.Args[1:]); err != nil {
+		return err
+	}
 
 	/////////////////////////////
 	// Highjack execution flow //
 	// That is to handle the flags that trigger an action and exit immediately.
 
-	library := noerr(prompts.Embedded())
+	library, err := prompts.Embedded()
+	if err != nil {
+		return errs.ConfigErr(err)
+	}
 
 	if cfg.List {
 		for name := range library.Prompts {
 			fmt.Println(name)
 		}
-		os.Exit(0)
+		return nil
 	}
 
 	if cfg.ListModels { // Align and print in sorted order.
 		specs, err := models.ModelSpecs()
 		if err != nil {
-			fatal(err)
+			return errs.ConfigErr(err)
 		}
 		longest := 0
 		for _, spec := range specs {
@@ -62,25 +105,436 @@ func main() {
 			}
 		}
 
-		format := fmt.Sprintf("%%-%ds  (%%s/%%s)\n", longest)
+		format := fmt.Sprintf("%%-%ds  (%%s/%%s)%%s\n", longest)
 		for _, short := range slices.Sorted(maps.Keys(specs)) {
 			spec := specs[short]
-			fmt.Printf(format, spec.ShortName, spec.Provider, spec.Author)
+			capabilities := ""
+			if len(spec.Capabilities) > 0 {
+				capabilities = " [" + strings.Join(spec.Capabilities, ", ") + "]"
+			}
+			fmt.Printf(format, spec.ShortName, spec.Provider, spec.Author, capabilities)
 		}
-		os.Exit(0)
+		return nil
 	}
 
 	if dumpConfig {
-		spec := noerr(modelSpec(cfg))
+		spec, err := modelSpec(cfg)
+		if err != nil {
+			return err
+		}
 		fmt.Println("Model:", pretty(spec))
 		fmt.Println("Config:", pretty(cfg))
-		os.Exit(0)
+		return nil
 	}
 
 	///////////////
 	// Execution //
 
-	run(cfg, library)
+	return run(cfg, library)
+}
+
+//////////////
+// Commands //
+
+// command is a subcommand, selected by the first argument.
+// When the first argument is not a command, it is interpreted as a prompt.
+type command struct {
+	help string
+	run  func(args []string) error
+}
+
+var commands = map[string]command{
+	"commit": {"Generate a message for the staged changes and commit them", commitStaged},
+	"hooks":  {"Install or uninstall the git hooks calling jenai", installHooks},
+	"index":  {"Index the files of the project for --auto-context and --rag", indexFiles},
+	"review": {"Review a range of commits chunk by chunk", reviewRange},
+	"mcp":    {"Serve prompts and context tools with the Model Context Protocol", mcpServe},
+	"rpc":    {"Serve editors with JSON-RPC over stdio", rpc},
+	"serve":  {"Expose the prompt library over HTTP", serve},
+}
+
+func commandsHelp() string {
+	var buf strings.Builder
+	buf.WriteString("\nCommands:\n")
+	for _, name := range slices.Sorted(maps.Keys(commands)) {
+		fmt.Fprintf(&buf, "  %-8s  %s\n", name, commands[name].help)
+	}
+
+	return buf.String()
+}
+
+// commandParser returns a parser for the flags of a command.
+func commandParser(name, usage string) *flag.Parser {
+	parser := flag.NewParser()
+	flag.WithHelp(os.Args[0]+" "+name, usage)(parser)
+	return parser
+}
+
+// parseCommand parses the arguments of a command, rejecting more than maxPositional positional
+// arguments.
+func parseCommand(parser *flag.Parser, args []string, maxPositional int) error {
+	if err := parser.Parse(args); err != nil {
+		return errs.InputErr(err)
+	}
+
+	if len(parser.Positional) > maxPositional {
+		return errs.InputErr(fmt.Errorf("unexpected arguments: %v", parser.Positional[maxPositional:]))
+	}
+
+	return nil
+}
+
+func serve(args []string) error {
+	var addr, model string
+	parser := commandParser("serve", "")
+	var secretsCfg config.Secrets
+	parser.String("addr", &addr, "Address to listen on").Default("localhost:8080")
+	parser.String("model", &model, "Default model (short name or provider:author/model)").
+		Alias("m").Default("ds3.2")
+	secretsCfg.Register(parser)
+	if err := parseCommand(parser, args, 0); err != nil {
+		return err
+	}
+
+	lib, spec, err := libraryAndModel(model)
+	if err != nil {
+		return err
+	}
+	srv := server.New(lib, spec)
+	if srv.Client.Secrets, err = secretPolicy(secretsCfg); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "Serving prompts on", addr)
+	return http.ListenAndServe(addr, srv)
+}
+
+func rpc(args []string) error {
+	var model string
+	var secretsCfg config.Secrets
+	parser := commandParser("rpc", "")
+	parser.String("model", &model, "Default model (short name or provider:author/model)").
+		Alias("m").Default("ds3.2")
+	secretsCfg.Register(parser)
+	if err := parseCommand(parser, args, 0); err != nil {
+		return err
+	}
+
+	lib, spec, err := libraryAndModel(model)
+	if err != nil {
+		return err
+	}
+	srv := editor.New(lib, spec)
+	if srv.Client.Secrets, err = secretPolicy(secretsCfg); err != nil {
+		return err
+	}
+
+	return srv.Serve(context.Background(), os.Stdin, os.Stdout)
+}
+
+func mcpServe(args []string) error {
+	var (
+		root       string
+		secretsCfg config.Secrets
+	)
+	parser := commandParser("mcp", "")
+	parser.String("root", &root, "Directory the tools can read from").Default(".")
+	secretsCfg.Register(parser)
+	if err := parseCommand(parser, args, 0); err != nil {
+		return err
+	}
+
+	lib, err := prompts.Embedded()
+	if err != nil {
+		return errs.ConfigErr(err)
+	}
+
+	toolbox := tools.Toolbox{Root: root}
+	server := mcp.New(lib, tools.NewSet(toolbox.Context()...))
+	if server.Secrets, err = secretPolicy(secretsCfg); err != nil {
+		return err
+	}
+	return server.Serve(context.Background(), os.Stdin, os.Stdout)
+}
+
+func commitStaged(args []string) error {
+	var (
+		model, attempts                 string
+		conventional, noEdit, printOnly bool
+	)
+	parser := commandParser("commit", "[INSTRUCTIONS...]")
+	parser.String("attempts", &attempts,
+		"Maximum number of messages generated to respect the conventional format").Default("3")
+	parser.Bool("conventional", &conventional, "Enforce the conventional commits format")
+	parser.String("model", &model, "Model name (short name or provider:author/model)").
+		Alias("m").Default("ds3.2")
+	parser.Bool("no-edit", &noEdit, "Commit without opening the message in the editor")
+	parser.Bool("print", &printOnly, "Print the message without committing")
+	var secretsCfg config.Secrets
+	secretsCfg.Register(parser)
+	if err := parseCommand(parser, args, math.MaxInt); err != nil {
+		return err
+	}
+
+	maxAttempts, err := positiveInt("attempts", attempts)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	staged, err := commit.Staged(ctx)
+	if err != nil {
+		return errs.InputErr(fmt.Errorf("cannot inspect the staged changes: %w", err))
+	}
+	if !staged {
+		return errs.InputErr(errors.New("nothing is staged"))
+	}
+
+	lib, spec, err := libraryAndModel(model)
+	if err != nil {
+		return err
+	}
+	session, err := config.NewSession("")
+	if err != nil {
+		return err
+	}
+
+	client := jenai.New(lib, spec, session)
+	if client.Secrets, err = secretPolicy(secretsCfg); err != nil {
+		return err
+	}
+	prompt, err := client.Build(jenai.Options{Name: "commit_message", Args: parser.Positional})
+	if err != nil {
+		return err
+	}
+	if conventional {
+		if err := addInstruction(lib, &prompt, "conventional_commit"); err != nil {
+			return err
+		}
+	}
+
+	writer := commit.Writer{
+		Client:       client,
+		Conventional: conventional,
+		MaxAttempts:  maxAttempts,
+		Retry: func(err error) {
+			fmt.Fprintln(os.Stderr, "Regenerating the commit message:", err)
+		},
+	}
+	message, err := writer.Write(ctx, prompt)
+	if err != nil {
+		return err
+	}
+
+	if printOnly {
+		fmt.Print(message)
+		return nil
+	}
+
+	if !noEdit {
+		if message, err = commit.Edit(ctx, message); err != nil {
+			return errs.InputErr(err)
+		}
+		if message == "" {
+			return errs.InputErr(errors.New("aborting the commit because of the empty message"))
+		}
+		if conventional {
+			if err := commit.Conventional(message); err != nil {
+				err = fmt.Errorf("the edited message is not conventional: %w", err)
+				// The edits are kept to be fixed, as git keeps the message of a failed commit.
+				if path, saveErr := commit.Save(ctx, message); saveErr != nil {
+					err = fmt.Errorf("%w (cannot save the message: %w)", err, saveErr)
+				} else {
+					err = fmt.Errorf("%w (saved to %s, reuse it with git commit -eF %[2]s)", err, path)
+				}
+				return errs.InputErr(err)
+			}
+		}
+	}
+
+	return commit.Commit(ctx, message)
+}
+
+func installHooks(args []string) error {
+	var force bool
+	parser := commandParser("hooks", "install|uninstall")
+	parser.Bool("force", &force, "Replace existing hooks, backing them up")
+	if err := parseCommand(parser, args, 1); err != nil {
+		return err
+	}
+
+	dir, err := hooks.Dir(context.Background())
+	if err != nil {
+		return errs.InputErr(err)
+	}
+
+	switch action := strings.Join(parser.Positional, ""); action {
+	case "install":
+		if err := hooks.Install(dir, force); err != nil {
+			return err
+		}
+		fmt.Println("Installed hooks in", dir, "(set JENAI_SKIP_HOOKS=1 to bypass them)")
+	case "uninstall":
+		if err := hooks.Uninstall(dir); err != nil {
+			return err
+		}
+		fmt.Println("Uninstalled hooks from", dir)
+	default:
+		return errs.InputErr(fmt.Errorf("expected install or uninstall, got %q", action))
+	}
+
+	return nil
+}
+
+func indexFiles(args []string) error {
+	var (
+		embeddings config.Embeddings
+		secretsCfg config.Secrets
+	)
+	parser := commandParser("index", "")
+	embeddings.Register(parser)
+	secretsCfg.Register(parser)
+	if err := parseCommand(parser, args, 0); err != nil {
+		return err
+	}
+
+	var err error
+	if embeddings.Secrets, err = secretPolicy(secretsCfg); err != nil {
+		return err
+	}
+	embedder, err := embeddings.New()
+	if err != nil {
+		return errs.InputErr(err)
+	}
+
+	root := config.ProjectRoot()
+	if _, err := index.Open(root); err != nil {
+		return errs.ContextErr(err)
+	}
+
+	store, err := index.LoadStore(root, embedder)
+	if err != nil {
+		return errs.ContextErr(err)
+	}
+	updated, err := store.Refresh(context.Background(), embedder)
+	if err != nil {
+		return errs.ContextErr(err)
+	}
+	if err := store.Save(); err != nil {
+		return errs.ContextErr(err)
+	}
+
+	fmt.Printf("Indexed %d files in %d chunks (%d updated) with %s\n",
+		len(store.Files), store.Chunks(), updated, embedder.Name())
+	return nil
+}
+
+func reviewRange(args []string) error {
+	var model, session, budget, jobs, format string
+	var cacheCfg config.Cache
+	parser := commandParser("review", "RANGE")
+	cacheCfg.Register(parser)
+	var secretsCfg config.Secrets
+	secretsCfg.Register(parser)
+	parser.String("budget", &budget, "Maximum number of tokens of the diff reviewed at once").
+		Default("8000")
+	parser.String("format", &format, "Output format: text, sarif or github").Default("text")
+	parser.String("jobs", &jobs, "Number of chunks reviewed concurrently").Default("4")
+	parser.String("model", &model, "Model name (short name or provider:author/model)").
+		Alias("m").Default("ds3.2")
+	parser.String("session", &session, "Session recording the synthesis")
+	if err := parseCommand(parser, args, 1); err != nil {
+		return err
+	}
+	if len(parser.Positional) == 0 {
+		return errs.InputErr(errors.New("missing range, for instance main..HEAD"))
+	}
+	if err := cacheCfg.Parse(); err != nil {
+		return errs.InputErr(err)
+	}
+	if err := review.CheckFormat(format); err != nil {
+		return errs.InputErr(err)
+	}
+
+	reviewer := review.Reviewer{Log: os.Stderr}
+	var err error
+	if reviewer.Budget, err = positiveInt("budget", budget); err != nil {
+		return err
+	}
+	if reviewer.Jobs, err = positiveInt("jobs", jobs); err != nil {
+		return err
+	}
+
+	lib, spec, err := libraryAndModel(model)
+	if err != nil {
+		return err
+	}
+	metadata, err := config.NewSession(session)
+	if err != nil {
+		return err
+	}
+	reviewer.Client = jenai.New(lib, spec, metadata)
+	if reviewer.Client.Secrets, err = secretPolicy(secretsCfg); err != nil {
+		return err
+	}
+	useCache(reviewer.Client, &cacheCfg)
+	reviewer.Client.Output = os.Stdout
+
+	ctx := context.Background()
+	diff, err := review.Diff(ctx, parser.Positional[0])
+	if err != nil {
+		return err
+	}
+
+	if format != "text" {
+		issues, err := reviewer.Issues(ctx, diff)
+		if err != nil {
+			return err
+		}
+		return review.WriteIssues(os.Stdout, format, issues)
+	}
+
+	_, err = reviewer.Review(ctx, diff)
+	return err
+}
+
+// useCache makes the client answer from the cache when it is active.
+func useCache(client *jenai.Client, cfg *config.Cache) {
+	if !cfg.Active() {
+		return
+	}
+
+	client.Backend = jenai.Cached{
+		Backend: client.Backend,
+		Cache:   cache.New(cfg.Dir(), cfg.TTL),
+		Refresh: cfg.Refresh,
+		Log:     os.Stderr,
+	}
+}
+
+// positiveInt converts the value of a command flag to a positive integer.
+func positiveInt(name, value string) (int, error) {
+	res, err := strconv.Atoi(value)
+	if err != nil || res < 1 {
+		return 0, errs.InputErr(fmt.Errorf("--%s expects a positive integer, got %q", name, value))
+	}
+
+	return res, nil
+}
+
+// libraryAndModel loads the embedded prompt library and resolves the model.
+func libraryAndModel(model string) (prompts.Library, models.Spec, error) {
+	lib, err := prompts.Embedded()
+	if err != nil {
+		return prompts.Library{}, models.Spec{}, errs.ConfigErr(err)
+	}
+
+	spec, err := models.Resolve(model)
+	if err != nil {
+		return prompts.Library{}, models.Spec{}, errs.ConfigErr(err)
+	}
+
+	return lib, spec, nil
 }
 
 //////////////////////////
@@ -92,7 +546,8 @@ func ensureConfig() error {
 		return err
 	}
 
-	fmt.Println("Initialized config file in", configDir)
+	// Stdout is reserved to the answer, which hooks capture.
+	fmt.Fprintln(os.Stderr, "Initialized config file in", configDir)
 
 	err = writeConfigFile("models.yaml", models.EmbeddedBytes)
 	if err != nil {
@@ -152,106 +607,399 @@ func conf() (*config.Jenai, *flag.Parser) {
 	return &cfg, parser
 }
 
-func run(cfg *config.Jenai, lib prompts.Library) {
-	prompt := noerr(cfg.BuildPrompt(lib))
+func run(cfg *config.Jenai, lib prompts.Library) error {
+	structured := cfg.Format != "text"
+	if err := review.CheckFormat(cfg.Format); err != nil {
+		return errs.InputErr(err)
+	}
+	if structured && cfg.Patch.Enabled {
+		return errs.InputErr(errors.New("--format and --patch cannot be used together"))
+	}
+	if cfg.Extract.Mode != "" && (structured || cfg.Patch.Enabled) {
+		return errs.InputErr(errors.New("--extract cannot be used with --format or --patch"))
+	}
+	if cfg.MapReduce.Enabled && cfg.Agent.Enabled {
+		return errs.InputErr(errors.New("--map-reduce and --agent cannot be used together"))
+	}
+	if len(cfg.Context.Images) > 0 && (cfg.MapReduce.Enabled || cfg.Agent.Enabled) {
+		return errs.InputErr(errors.New("--image cannot be used with --map-reduce or --agent"))
+	}
+	if cfg.MapReduce.Enabled && (cfg.MapReduce.Budget < 1 || cfg.MapReduce.Jobs < 1) {
+		return errs.InputErr(errors.New("--budget and --jobs must be positive"))
+	}
+	if cfg.Agent.Enabled && cfg.Agent.MaxSteps < 1 {
+		return errs.InputErr(errors.New("--max-steps must be positive"))
+	}
+	if cfg.Context.RAG < 0 {
+		return errs.InputErr(errors.New("--rag must not be negative"))
+	}
+	if structured { // Findings are anchored to lines.
+		cfg.Context.LineNumbers = true
+	}
+
+	policy, err := secretPolicy(cfg.Secrets)
+	if err != nil {
+		return err
+	}
+	cfg.Context.Embeddings.Secrets = policy
+
+	prompt, err := cfg.BuildPrompt(lib)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case cfg.Patch.Enabled:
+		err = addInstruction(lib, &prompt, "patch_format")
+	case structured:
+		if isDiff(prompt.Stdin) {
+			prompt.Stdin = review.NumberDiff(prompt.Stdin)
+		}
+		err = addInstruction(lib, &prompt, "structured_findings")
+	}
+	if err != nil {
+		return err
+	}
 
 	if cfg.DryRun {
-		fmt.Println(prompt)
-		os.Exit(0)
+		text, findings := policy.Scanner.Redact(prompt.String())
+		if cfg.Secrets.Allow {
+			text = prompt.String()
+		}
+		fmt.Println(text)
+		printAttachments(prompt.Attachments)
+		if len(findings) > 0 {
+			fmt.Fprintf(os.Stderr, "\nSecrets found in the prompt:\n%s", secrets.Report(findings))
+		}
+		return nil
+	}
+
+	spec, err := modelSpec(cfg)
+	if err != nil {
+		return err
+	}
+	session, err := cfg.Session()
+	if err != nil {
+		return err
 	}
 
-	spec := noerr(modelSpec(cfg))
-	session := noerr(cfg.Session())
-	aichat := func(stdin io.Reader) {
-		cmd := exec.Command("aichat",
-			"--model", spec.Aichat(), "--session", session.Name, "--save-session")
-		cmd.Env = append(cmd.Env, "AICHAT_COMPRESS_THRESHOLD=10000",
-			"AICHAT_SESSIONS_DIR="+session.Dir)
-		cmd.Stdin = stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		noerr0(cmd.Run())
+	client := jenai.New(lib, spec, session)
+	client.Secrets = policy
+	useCache(client, &cfg.Cache)
+	// The transcript of an interactive run only holds its own messages, not those of the resumed
+	// session.
+	skipped := client.SessionLength()
+	// Structured findings are written once parsed, and code blocks once extracted.
+	if !structured && cfg.Extract.Mode == "" {
+		client.Output = os.Stdout
 	}
+	ctx := context.Background()
 
-	if prompt.Empty() && !session.Requested {
-		fatal(errors.New("the prompt is empty"))
+	// In map-reduce mode, the context alone is enough to be processed.
+	empty := prompt.Empty() && (!cfg.MapReduce.Enabled || prompt.Context == "")
+	if empty && !session.Requested {
+		return errs.InputErr(errors.New("the prompt is empty"))
 	}
 
-	if !prompt.Empty() {
-		aichat(strings.NewReader(prompt.String()))
-		if cfg.TeeFile != "" {
-			if err := tee(cfg.TeeFile, session, prompt); err != nil {
-				fmt.Fprintf(os.Stderr,
-					"can't tee to %s (will proceed nonetheless): %s", cfg.TeeFile, err)
+	if !empty {
+		reply, err := ask(ctx, cfg, client, prompt)
+		if err != nil {
+			return err
+		}
+		if cfg.Extract.Mode != "" {
+			if reply.Content, err = extractBlocks(cfg, reply.Content); err != nil {
+				return err
+			}
+			if reply.Content != "" {
+				fmt.Println(reply.Content)
+			}
+		}
+		if cfg.Copy {
+			copyAnswer(reply.Content)
+		}
+		if cfg.Tee.File != "" && !cfg.Interactive { // The whole conversation is written later.
+			tee(client, cfg.Tee, prompt, []config.Message{{Role: "assistant", Content: reply.Content}})
+		}
+		if cfg.Patch.Enabled {
+			if err := applyPatch(cfg.Patch, reply.Content); err != nil {
+				return err
+			}
+		}
+		if structured {
+			issues := review.SortIssues(review.ParseIssues(reply.Content))
+			if err := review.WriteIssues(os.Stdout, cfg.Format, issues); err != nil {
+				return err
 			}
 		}
 	}
 
 	// Handle interactive mode.
-	if cfg.Interactive || (session.Requested && prompt.Empty()) {
-		aichat(os.Stdin)
+	if cfg.Interactive || (session.Requested && empty) {
+		if err := client.Interact(ctx, os.Stdin); err != nil {
+			return err
+		}
+
+		if cfg.Tee.File != "" {
+			messages, err := client.Conversation(skipped)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "can't tee to %s: %s\n", cfg.Tee.File, err)
+				return nil
+			}
+			tee(client, cfg.Tee, prompt, messages)
+		}
 	}
+
+	return nil
 }
 
-func tee(teefile string, session config.SessionMetadata, prompt config.Prompt) error {
-	conv, err := session.Load()
+// copyAnswer puts the answer in the clipboard, only warning about failures.
+func copyAnswer(answer string) {
+	board, err := clipboard.Detect(true)
+	if err == nil {
+		err = board.Write(answer)
+	}
 	if err != nil {
-		return err
+		fmt.Fprintf(os.Stderr, "can't copy the answer (will proceed nonetheless): %s\n", err)
 	}
+}
 
-	if len(conv.Messages) == 0 {
-		return fmt.Errorf("no message in session")
+// tee writes the messages to the tee file, only warning about failures.
+func tee(client *jenai.Client, cfg config.Tee, prompt jenai.Prompt, messages []config.Message) {
+	if err := client.Tee(cfg, prompt, messages); err != nil {
+		fmt.Fprintf(os.Stderr, "can't tee to %s (will proceed nonetheless): %s\n", cfg.File, err)
 	}
+}
 
-	last := conv.Messages[len(conv.Messages)-1]
-	metadata, err := yaml.Marshal(map[string]any{
-		"date":    time.Now().Format("2006-01-02"),
-		"model":   conv.Model,
-		"prompt":  prompt.Static(),
-		"context": prompt.Paths,
-	})
+// secretPolicy returns the policy applied to the messages sent to the model, with the user rules of
+// secrets.yaml.
+// The messages containing secrets are blocked unless cfg allows or redacts them.
+func secretPolicy(cfg config.Secrets) (secrets.Policy, error) {
+	scanner, err := secrets.Load(filepath.Join(configDir, "secrets.yaml"))
 	if err != nil {
-		return err
+		return secrets.Policy{}, errs.ConfigErr(err)
 	}
 
-	content := strings.Join([]string{"---", string(metadata) + "---\n", last.Content}, "\n")
-	return os.WriteFile(teefile, []byte(content), 0644)
+	return secrets.Policy{
+		Scanner: scanner,
+		Allow:   cfg.Allow,
+		Redact:  cfg.Redact,
+		Log:     os.Stderr,
+		Hint:    "remove them or use --redact-secrets or --allow-secrets",
+	}, nil
 }
 
-func modelSpec(cfg *config.Jenai) (models.Spec, error) {
-	fromZoo := func() (models.Spec, error) { return models.Get(cfg.Model) }
+// printAttachments lists the attachments of a prompt, with their type and size.
+func printAttachments(attachments []string) {
+	if len(attachments) == 0 {
+		return
+	}
 
-	// Model specified directly in aichat's provider:author/model formet.
-	provider, rest, found := strings.Cut(cfg.Model, ":")
-	if !found {
-		return fromZoo()
+	fmt.Println("\n# Attachments")
+	for _, attachment := range attachments {
+		description := mime.TypeByExtension(filepath.Ext(attachment))
+		if info, err := os.Stat(attachment); err == nil {
+			description += fmt.Sprintf(", %d bytes", info.Size())
+		}
+		fmt.Printf("- %s (%s)\n", attachment, strings.TrimPrefix(description, ", "))
+	}
+}
+
+// ask sends the prompt, letting the model call tools in agentic mode or processing the input in
+// chunks in map-reduce mode.
+func ask(
+	ctx context.Context, cfg *config.Jenai, client *jenai.Client, prompt jenai.Prompt,
+) (jenai.Reply, error) {
+	if cfg.MapReduce.Enabled {
+		mr := mapreduce.MapReduce{
+			Client:   client,
+			Map:      cfg.MapReduce.Map,
+			Reduce:   cfg.MapReduce.Reduce,
+			Budget:   cfg.MapReduce.Budget,
+			Boundary: prompt.Boundary,
+			Jobs:     cfg.MapReduce.Jobs,
+			Log:      os.Stderr,
+		}
+		task := jenai.Prompt{Primary: prompt.Primary, Positional: prompt.Positional, Extra: prompt.Extra}
+		input := jenai.Prompt{Clipboard: prompt.Clipboard, Stdin: prompt.Stdin, Context: prompt.Context}
+		return mr.Run(ctx, task.String(), input.String())
 	}
 
-	author, model, found := strings.Cut(rest, "/")
-	if !found {
-		return fromZoo()
+	if !cfg.Agent.Enabled {
+		return client.Ask(ctx, prompt)
 	}
 
-	return models.Spec{Provider: provider, Author: author, Model: model}, nil
+	toolbox := tools.Toolbox{Root: ".", Allowed: cfg.Agent.AllowedCommands}
+	ag := agent.Agent{
+		Client:   client,
+		Tools:    tools.NewSet(toolbox.Local()...),
+		MaxSteps: cfg.Agent.MaxSteps,
+		Log:      os.Stderr,
+	}
+	return ag.Run(ctx, prompt)
+}
+
+// addInstruction appends an instruction to the prompt.
+func addInstruction(lib prompts.Library, prompt *jenai.Prompt, name string) error {
+	instruction, err := prompts.NewEvalContext(lib, nil).Instruction(name)
+	if err != nil {
+		return errs.PromptErr(err)
+	}
+
+	prompt.Extra = append(prompt.Extra, instruction)
+	return nil
+}
+
+// isDiff returns true when text looks like a unified diff.
+func isDiff(text string) bool {
+	return strings.HasPrefix(text, "diff --git ") || strings.Contains(text, "\n@@ -")
+}
+
+// extractBlocks returns the code blocks of the answer selected by --extract and --extract-lang.
+// In files mode, the blocks hinting a path are written to it after confirmation, and the other
+// blocks are returned.
+func extractBlocks(cfg *config.Jenai, answer string) (string, error) {
+	blocks := codeblock.Filter(codeblock.Parse(answer), cfg.Extract.Language)
+	if len(blocks) == 0 {
+		lang := ""
+		if cfg.Extract.Language != "" {
+			lang = " in " + cfg.Extract.Language
+		}
+		return "", errs.BackendErr(fmt.Errorf("the answer does not contain code blocks%s", lang))
+	}
+
+	switch cfg.Extract.Mode {
+	case "first":
+		return codeblock.Join(blocks[:1]), nil
+	case "all":
+		return codeblock.Join(blocks), nil
+	}
+
+	var files, rest []codeblock.Block
+	for _, block := range blocks {
+		if block.Path == "" {
+			rest = append(rest, block)
+		} else {
+			files = append(files, block)
+		}
+	}
+	if len(files) == 0 {
+		return "", errs.BackendErr(errors.New("no code block of the answer hints a file path"))
+	}
+
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+
+	if !cfg.Patch.Yes {
+		confirmed, err := confirm("Write " + strings.Join(paths, ", ") + "?")
+		if err != nil {
+			return "", errs.InputErr(err)
+		}
+		if !confirmed {
+			fmt.Fprintln(os.Stderr, "Files not written.")
+			return codeblock.Join(rest), nil
+		}
+	}
+
+	if err := codeblock.Write(".", files, cfg.Extract.Overwrite); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return "", errs.InputErr(fmt.Errorf("%w, pass --overwrite to replace it", err))
+		}
+		return "", errs.BackendErr(err)
+	}
+	fmt.Fprintln(os.Stderr, "Wrote", strings.Join(paths, ", "))
+
+	return codeblock.Join(rest), nil
+}
+
+// applyPatch parses the patch in the answer and applies it to the working tree once the user has
+// confirmed the preview.
+// Paths are relative to the root of the repo, as requested by the patch_format instruction.
+func applyPatch(cfg config.Patch, answer string) error {
+	parsed, err := patch.Parse(answer)
+	if err != nil {
+		return errs.BackendErr(fmt.Errorf("the answer does not contain a valid patch: %w", err))
+	}
+
+	root := config.ProjectRoot()
+	changes, err := parsed.Validate(root)
+	if err != nil {
+		return errs.BackendErr(fmt.Errorf("the patch does not apply:\n%w", err))
+	}
+
+	fmt.Println()
+	patch.Preview(os.Stdout, changes, colored(os.Stdout))
+
+	if !cfg.Yes {
+		confirmed, err := confirm("Apply these changes?")
+		if err != nil {
+			return errs.InputErr(err)
+		}
+		if !confirmed {
+			fmt.Println("Patch not applied.")
+			return nil
+		}
+	}
+
+	if err := patch.Apply(root, changes); err != nil {
+		return err
+	}
+	fmt.Println("Patched", strings.Join(parsed.Paths(), ", "))
+
+	if cfg.Stage {
+		return patch.Stage(root, changes)
+	}
+
+	return nil
+}
+
+func modelSpec(cfg *config.Jenai) (models.Spec, error) {
+	spec, err := models.Resolve(cfg.Model)
+	return spec, errs.ConfigErr(err)
 }
 
 ////////////////
 // Primitives //
 
+// fatal reports err on stderr and exits with the code matching its kind.
 func fatal(err error) {
-	fmt.Println("Error:", err)
-	os.Exit(1)
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	os.Exit(errs.ExitCode(err))
 }
 
-func noerr[T any](res T, err error) T {
+// confirm asks a yes/no question on the terminal, even when stdin is redirected.
+func confirm(question string) (bool, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
 	if err != nil {
-		fatal(err)
+		return false, fmt.Errorf("cannot ask for confirmation (use --yes to skip it): %w", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, err
 	}
-	return res
+
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
 }
 
-func noerr0(err error) { noerr(0, err) }
+// colored returns true when ANSI colors should be written to file.
+func colored(file *os.File) bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
 
 func pretty(data any) string {
-	return string(noerr(json.MarshalIndent(data, "", "  ")))
+	res, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%+v", data)
+	}
+	return string(res)
 }
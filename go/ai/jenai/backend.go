@@ -0,0 +1,157 @@
+package jenai
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mooss/jen/go/ai/cache"
+	"github.com/mooss/jen/go/ai/config"
+	"github.com/mooss/jen/go/ai/models"
+)
+
+// Request is a message addressed to a model within a session.
+type Request struct {
+	Model   models.Spec
+	Session config.SessionMetadata
+	Message string
+	// Attachments are the images sent along with the message, as paths or URLs.
+	Attachments []string
+}
+
+// Backend sends messages to a model.
+type Backend interface {
+	// Send sends the message of the request, streams the answer to out and returns it.
+	Send(ctx context.Context, req Request, out io.Writer) (string, error)
+}
+
+// Interactive is implemented by backends that can hold an interactive chat.
+type Interactive interface {
+	// Interact reads user messages from in and writes the answers to out until in is exhausted.
+	Interact(ctx context.Context, req Request, in io.Reader, out io.Writer) error
+}
+
+////////////
+// Aichat //
+
+// Aichat is a backend delegating to the aichat command.
+// Sessions are saved by aichat in the session directory.
+type Aichat struct{}
+
+func (Aichat) Send(ctx context.Context, req Request, out io.Writer) (string, error) {
+	var buf bytes.Buffer
+	err := Aichat{}.run(ctx, req, strings.NewReader(req.Message), io.MultiWriter(out, &buf))
+	return buf.String(), err
+}
+
+func (Aichat) Interact(ctx context.Context, req Request, in io.Reader, out io.Writer) error {
+	if out == nil {
+		out = os.Stdout
+	}
+
+	return Aichat{}.run(ctx, req, in, out)
+}
+
+func (Aichat) run(ctx context.Context, req Request, in io.Reader, out io.Writer) error {
+	args := []string{"--model", req.Model.Aichat()}
+	if req.Session.Name != "" {
+		args = append(args, "--session", req.Session.Name, "--save-session")
+	}
+	for _, attachment := range req.Attachments {
+		args = append(args, "--file", attachment)
+	}
+
+	cmd := exec.CommandContext(ctx, "aichat", args...)
+	cmd.Env = append(cmd.Env, "AICHAT_COMPRESS_THRESHOLD=10000",
+		"AICHAT_SESSIONS_DIR="+req.Session.Dir)
+	cmd.Stdin = in
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("aichat failed: %w", err)
+	}
+
+	return nil
+}
+
+////////////
+// Cached //
+
+// Cached is a backend answering from a cache when the same message was already sent to the same
+// model, and delegating to another backend otherwise.
+// Cached answers are still recorded in the session.
+type Cached struct {
+	Backend Backend
+	Cache   *cache.Cache
+	// Refresh ignores the cached answers, the new answers are still cached.
+	Refresh bool
+	// Log receives the cache hits, it can be nil.
+	Log io.Writer
+}
+
+func (c Cached) Send(ctx context.Context, req Request, out io.Writer) (string, error) {
+	key := cacheKey(req)
+	if entry, hit := c.Cache.Get(key); hit && !c.Refresh {
+		if c.Log != nil {
+			fmt.Fprintf(c.Log, "Cached answer of %s from %s\n",
+				entry.Model, entry.Created.Format("2006-01-02 15:04"))
+		}
+
+		err := req.Session.Append(req.Model.Aichat(),
+			config.Message{Role: "user", Content: req.Message},
+			config.Message{Role: "assistant", Content: entry.Answer})
+		if err != nil {
+			return "", err
+		}
+
+		_, err = io.WriteString(out, entry.Answer)
+		return entry.Answer, err
+	}
+
+	answer, err := c.Backend.Send(ctx, req, out)
+	if err != nil {
+		return "", err
+	}
+
+	if err := c.Cache.Put(key, cache.Entry{Model: req.Model.Aichat(), Answer: answer}); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to cache the answer (will proceed nonetheless):", err)
+	}
+
+	return answer, nil
+}
+
+func (c Cached) Interact(ctx context.Context, req Request, in io.Reader, out io.Writer) error {
+	backend, ok := c.Backend.(Interactive)
+	if !ok {
+		return fmt.Errorf("%T does not support interactive sessions", c.Backend)
+	}
+
+	return backend.Interact(ctx, req, in, out)
+}
+
+// cacheKey returns the cache key of a request, from everything that influences the answer.
+// The content of local attachments and the previous messages of the session are part of the key,
+// so that a follow-up such as "continue" is not answered from another point of a conversation.
+func cacheKey(req Request) string {
+	parts := []string{req.Model.Aichat(), req.Message}
+	if req.Session.Name != "" {
+		if conv, err := req.Session.Load(); err == nil {
+			for _, message := range conv.Messages {
+				parts = append(parts, message.Role, message.Content)
+			}
+		}
+	}
+	for _, attachment := range req.Attachments {
+		parts = append(parts, attachment)
+		if data, err := os.ReadFile(attachment); err == nil {
+			parts = append(parts, cache.Key(string(data)))
+		}
+	}
+
+	return cache.Key(parts...)
+}
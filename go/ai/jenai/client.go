@@ -0,0 +1,169 @@
+// Package jenai exposes jenai's prompt library and session handling as a Go API.
+// The jenai command is a thin wrapper over this package.
+package jenai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mooss/jen/go/ai/config"
+	"github.com/mooss/jen/go/ai/errs"
+	"github.com/mooss/jen/go/ai/models"
+	"github.com/mooss/jen/go/ai/prompts"
+	"github.com/mooss/jen/go/ai/secrets"
+)
+
+// Prompt is a fully built prompt.
+type Prompt = config.Prompt
+
+// Options are the sources a prompt is built from.
+type Options = config.Options
+
+// Reply is the answer of the model to a prompt.
+type Reply struct {
+	// Content is the text of the answer.
+	Content string
+	// Model is the full name of the model that answered.
+	Model string
+	// Session is the name of the session the exchange was recorded in.
+	Session string
+}
+
+// Client builds prompts from a library and sends them to a model.
+type Client struct {
+	// Library is used to evaluate named prompts.
+	Library prompts.Library
+	// Model is the model prompts are sent to.
+	Model models.Spec
+	// Session is the chat session where the exchanges are recorded.
+	Session config.SessionMetadata
+	// Backend sends the messages to the model.
+	Backend Backend
+	// Output receives the answer while it is generated, it can be nil.
+	Output io.Writer
+	// Secrets decides what happens to the messages containing secrets, blocked by default.
+	Secrets secrets.Policy
+}
+
+// New returns a client using aichat as its backend.
+func New(lib prompts.Library, model models.Spec, session config.SessionMetadata) *Client {
+	return &Client{
+		Library: lib,
+		Model:   model,
+		Session: session,
+		Backend: Aichat{},
+	}
+}
+
+// NewDefault returns a client for the given model name using the embedded prompt library and a new
+// session.
+func NewDefault(model string) (*Client, error) {
+	lib, err := prompts.Embedded()
+	if err != nil {
+		return nil, errs.ConfigErr(err)
+	}
+
+	spec, err := models.Resolve(model)
+	if err != nil {
+		return nil, errs.ConfigErr(err)
+	}
+
+	session, err := config.NewSession("")
+	if err != nil {
+		return nil, err
+	}
+
+	return New(lib, spec, session), nil
+}
+
+// Fork returns a copy of the client, with the model and the session overridden when not empty.
+// The copy does not record its exchanges when session is empty, regardless of the original client.
+func (c *Client) Fork(model, session string) (*Client, error) {
+	res := *c
+	res.Session = config.SessionMetadata{}
+
+	if model != "" {
+		spec, err := models.Resolve(model)
+		if err != nil {
+			return nil, errs.InputErr(err)
+		}
+		res.Model = spec
+	}
+
+	if session != "" {
+		var err error
+		if res.Session, err = config.NewSession(session); err != nil {
+			return nil, err
+		}
+	}
+
+	return &res, nil
+}
+
+// Build evaluates the named prompt from the options and assembles it with the other sources.
+func (c *Client) Build(opts Options) (Prompt, error) {
+	return opts.Build(c.Library)
+}
+
+// Ask sends the prompt to the model and returns its reply.
+// The reply is also streamed to the output as it is generated.
+func (c *Client) Ask(ctx context.Context, prompt Prompt) (Reply, error) {
+	if prompt.Empty() {
+		return Reply{}, errs.InputErr(errors.New("the prompt is empty"))
+	}
+
+	if len(prompt.Attachments) > 0 && !c.Model.Has(models.Vision) {
+		capable, err := models.WithCapability(models.Vision)
+		if err != nil {
+			return Reply{}, errs.ConfigErr(err)
+		}
+		return Reply{}, errs.InputErr(fmt.Errorf(
+			"%s cannot read the attached images, use a model with vision such as %s",
+			c.Model.Aichat(), strings.Join(capable, ", ")))
+	}
+
+	return c.send(ctx, prompt.String(), prompt.Attachments)
+}
+
+// Send sends a raw message to the model, in the client's session.
+func (c *Client) Send(ctx context.Context, message string) (Reply, error) {
+	return c.send(ctx, message, nil)
+}
+
+// send sends every message to the model, after checking it for secrets.
+func (c *Client) send(ctx context.Context, message string, attachments []string) (Reply, error) {
+	message, err := c.Secrets.Apply(message)
+	if err != nil {
+		return Reply{}, errs.InputErr(err)
+	}
+
+	out := c.Output
+	if out == nil {
+		out = io.Discard
+	}
+
+	req := Request{
+		Model: c.Model, Session: c.Session, Message: message, Attachments: attachments,
+	}
+	content, err := c.Backend.Send(ctx, req, out)
+	if err != nil {
+		return Reply{}, errs.BackendErr(err)
+	}
+
+	return Reply{Content: content, Model: c.Model.Aichat(), Session: c.Session.Name}, nil
+}
+
+// Interact starts an interactive chat in the client's session, reading user input from in.
+// The backend must implement Interactive.
+func (c *Client) Interact(ctx context.Context, in io.Reader) error {
+	backend, ok := c.Backend.(Interactive)
+	if !ok {
+		return errs.InputErr(fmt.Errorf("%T does not support interactive sessions", c.Backend))
+	}
+
+	req := Request{Model: c.Model, Session: c.Session}
+	return errs.BackendErr(backend.Interact(ctx, req, in, c.Output))
+}
@@ -0,0 +1,152 @@
+//nolint:revive
+package jenai
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mooss/jen/go/ai/config"
+	"github.com/mooss/jen/go/ai/errs"
+	"github.com/mooss/jen/go/ai/models"
+	"github.com/mooss/jen/go/ai/prompts"
+)
+
+// fake records the requests and answers with the message it received.
+type fake struct{ reqs []Request }
+
+func (f *fake) Send(_ context.Context, req Request, out io.Writer) (string, error) {
+	f.reqs = append(f.reqs, req)
+	answer := "echo: " + req.Message
+	_, err := io.WriteString(out, answer)
+	return answer, err
+}
+
+func resolve(t *testing.T, model string) models.Spec {
+	t.Helper()
+	spec, err := models.Resolve(model)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return spec
+}
+
+func TestAsk(t *testing.T) {
+	tests := []struct {
+		name     string
+		model    string
+		prompt   Prompt
+		expected string
+		kind     errs.Kind
+	}{
+		{"Text", "ds3.2", Prompt{Primary: "hello"}, "echo: hello", errs.Internal},
+		{"Empty prompt", "ds3.2", Prompt{}, "", errs.Input},
+		{"Image without vision", "ds3.2",
+			Prompt{Primary: "describe", Attachments: []string{"cat.png"}}, "", errs.Input},
+		{"Image with vision", "gem25f",
+			Prompt{Primary: "describe", Attachments: []string{"cat.png"}}, "echo: describe",
+			errs.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := &fake{}
+			var out bytes.Buffer
+			session := config.SessionMetadata{Dir: t.TempDir(), Name: "chat"}
+			client := New(prompts.Library{}, resolve(t, tt.model), session)
+			client.Backend, client.Output = backend, &out
+
+			reply, err := client.Ask(context.Background(), tt.prompt)
+			if tt.kind != errs.Internal {
+				if errs.KindOf(err) != tt.kind || len(backend.reqs) != 0 {
+					t.Errorf("Expected a %s error before calling the model, got %v", tt.kind, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			expected := Reply{Content: tt.expected, Model: client.Model.Aichat(), Session: "chat"}
+			if reply != expected || out.String() != tt.expected {
+				t.Errorf("Expected %+v, got %+v (output %q)", expected, reply, out.String())
+			}
+			req := backend.reqs[0]
+			if !reflect.DeepEqual(req.Attachments, tt.prompt.Attachments) ||
+				req.Session != session || req.Model.Aichat() != client.Model.Aichat() {
+				t.Errorf("Unexpected request %+v", req)
+			}
+		})
+	}
+}
+
+func TestFork(t *testing.T) {
+	t.Chdir(t.TempDir()) // Sessions are created in the project directory.
+	backend := &fake{}
+	var out bytes.Buffer
+	session := config.SessionMetadata{Dir: t.TempDir(), Name: "original"}
+	client := New(prompts.Library{}, resolve(t, "ds3.2"), session)
+	client.Backend, client.Output = backend, &out
+
+	tests := []struct {
+		name    string
+		model   string
+		session string
+		aichat  string
+		err     bool
+	}{
+		{"Same model without session", "", "", client.Model.Aichat(), false},
+		{"Other model", "gem25f", "", resolve(t, "gem25f").Aichat(), false},
+		{"Full model name", "p:a/m", "", "p:a/m", false},
+		{"Other session", "", "forked", client.Model.Aichat(), false},
+		{"Unknown model", "nope", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fork, err := client.Fork(tt.model, tt.session)
+			if tt.err {
+				if errs.KindOf(err) != errs.Input {
+					t.Errorf("Expected an input error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if fork.Model.Aichat() != tt.aichat || fork.Session.Name != tt.session {
+				t.Errorf("Expected %s in session %q, got %s in session %q",
+					tt.aichat, tt.session, fork.Model.Aichat(), fork.Session.Name)
+			}
+			if fork.Backend != client.Backend || fork.Output != client.Output {
+				t.Error("Expected the fork to share the backend and the output")
+			}
+		})
+	}
+
+	if client.Model.Aichat() != resolve(t, "ds3.2").Aichat() || client.Session != session {
+		t.Errorf("Expected the original client to be untouched, got %+v", client)
+	}
+}
+
+func TestSendWithoutOutput(t *testing.T) {
+	backend := &fake{}
+	client := &Client{Backend: backend, Model: models.Spec{Provider: "p", Author: "a", Model: "m"}}
+
+	reply, err := client.Send(context.Background(), "raw")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reply.Content != "echo: raw" || reply.Model != "p:a/m" || reply.Session != "" {
+		t.Errorf("Unexpected reply %+v", reply)
+	}
+
+	err = client.Interact(context.Background(), strings.NewReader("hi"))
+	if errs.KindOf(err) != errs.Input {
+		t.Errorf("Expected an input error for a backend without interactive sessions, got %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+package jenai
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/mooss/jen/go/ai/config"
+	"github.com/mooss/jen/go/utils"
+)
+
+// Transcript is an exchange written to a tee file, along with metadata about the prompt.
+type Transcript struct {
+	Date  string `json:"date" yaml:"date"`
+	Model string `json:"model" yaml:"model"`
+	// Name and Args are the library prompt and its arguments, empty when there is none.
+	Name   string   `json:"name,omitempty" yaml:"name,omitempty"`
+	Args   []string `json:"args,omitempty" yaml:"args,omitempty"`
+	Prompt string   `json:"prompt" yaml:"prompt"`
+	// Context describes the files included in the prompt.
+	Context  []config.PathInfo `json:"context" yaml:"context"`
+	Tokens   Usage             `json:"estimated_tokens" yaml:"estimated_tokens"`
+	Messages []config.Message  `json:"messages" yaml:"-"`
+}
+
+// Usage is the number of tokens sent to and received from the model, estimated at four characters
+// per token since the backend does not report it.
+type Usage struct {
+	Input  int `json:"input" yaml:"input"`
+	Output int `json:"output" yaml:"output"`
+}
+
+// Transcript returns the transcript of the messages exchanged about the prompt.
+// The input tokens are those of the user messages, or of the prompt when there is none.
+func (c *Client) Transcript(prompt Prompt, messages []config.Message) Transcript {
+	res := Transcript{
+		Date:     time.Now().Format("2006-01-02"),
+		Model:    c.Model.Aichat(),
+		Name:     prompt.Name,
+		Args:     prompt.Args,
+		Prompt:   prompt.Static(),
+		Context:  prompt.Paths,
+		Messages: messages,
+	}
+	if res.Context == nil {
+		res.Context = []config.PathInfo{}
+	}
+
+	for _, message := range messages {
+		if message.Role == "user" {
+			res.Tokens.Input += utils.Tokens(message.Content)
+		} else {
+			res.Tokens.Output += utils.Tokens(message.Content)
+		}
+	}
+	if res.Tokens.Input == 0 {
+		res.Tokens.Input = utils.Tokens(prompt.String())
+	}
+
+	return res
+}
+
+// SessionLength returns the number of messages already in the client's session, zero when the
+// session does not exist yet.
+func (c *Client) SessionLength() int {
+	conv, err := c.Session.Load()
+	if err != nil {
+		return 0
+	}
+	return len(conv.Messages)
+}
+
+// Conversation returns the messages of the client's session after the first skipped ones, so that
+// a resumed session only yields the messages of the current run.
+func (c *Client) Conversation(skipped int) ([]config.Message, error) {
+	conv, err := c.Session.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(conv.Messages) <= skipped {
+		return nil, fmt.Errorf("no new message in session")
+	}
+
+	return conv.Messages[skipped:], nil
+}
+
+// Tee writes the transcript of the messages exchanged about the prompt to the file of the
+// configuration, in its format.
+// The file is overwritten unless the configuration appends to it.
+func (c *Client) Tee(tee config.Tee, prompt Prompt, messages []config.Message) error {
+	format, err := tee.FileFormat()
+	if err != nil {
+		return err
+	}
+
+	transcript := c.Transcript(prompt, messages)
+	var content string
+	switch format {
+	case "org":
+		content = transcript.Org()
+	case "json":
+		content, err = transcript.JSON()
+	default:
+		content, err = transcript.Markdown()
+	}
+	if err != nil {
+		return err
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if tee.Append {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		if info, err := os.Stat(tee.File); err == nil && info.Size() > 0 && format != "json" {
+			content = "\n" + content // Separates the transcripts.
+		}
+	}
+
+	file, err := os.OpenFile(tee.File, flags, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+/////////////
+// Formats //
+
+// Markdown returns the transcript with its metadata in a YAML front-matter.
+// A lone answer is written as is, the messages of a conversation are introduced by their role.
+func (t Transcript) Markdown() (string, error) {
+	metadata, err := yaml.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+
+	var buf strings.Builder
+	buf.WriteString("---\n" + string(metadata) + "---\n\n")
+	if len(t.Messages) == 1 {
+		buf.WriteString(ensureNewline(t.Messages[0].Content))
+		return buf.String(), nil
+	}
+
+	for i, message := range t.Messages {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "## %s\n\n%s", title(message.Role), ensureNewline(message.Content))
+	}
+
+	return buf.String(), nil
+}
+
+// Org returns the transcript as an org-mode entry, with its metadata in a property drawer.
+// The prompt and the messages are put in blocks so that their lines cannot start headings.
+func (t Transcript) Org() string {
+	var buf strings.Builder
+	heading := t.Name
+	if heading == "" {
+		heading = "jenai"
+	}
+	fmt.Fprintf(&buf, "* %s [%s]\n:PROPERTIES:\n", heading, t.Date)
+
+	property := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&buf, ":%s: %s\n", name, value)
+		}
+	}
+	paths := make([]string, len(t.Context))
+	for i, info := range t.Context {
+		paths[i] = info.Path
+	}
+	property("MODEL", t.Model)
+	property("NAME", t.Name)
+	property("ARGS", strings.Join(t.Args, " "))
+	property("CONTEXT", strings.Join(paths, " "))
+	property("INPUT_TOKENS", fmt.Sprint(t.Tokens.Input))
+	property("OUTPUT_TOKENS", fmt.Sprint(t.Tokens.Output))
+	buf.WriteString(":END:\n")
+
+	block := func(heading, content string) {
+		fmt.Fprintf(&buf, "** %s\n#+begin_src markdown\n%s#+end_src\n",
+			heading, ensureNewline(orgEscape(content)))
+	}
+	block("Prompt", t.Prompt)
+	for _, message := range t.Messages {
+		block(title(message.Role), message.Content)
+	}
+
+	return buf.String()
+}
+
+// JSON returns the transcript as a single line of JSON, so that appended transcripts form a JSON
+// lines file.
+func (t Transcript) JSON() (string, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data) + "\n", nil
+}
+
+///////////////////////
+// Utility functions //
+
+func ensureNewline(text string) string {
+	if text == "" || strings.HasSuffix(text, "\n") {
+		return text
+	}
+
+	return text + "\n"
+}
+
+// title returns the role with an uppercase first letter.
+func title(role string) string {
+	if role == "" {
+		return role
+	}
+
+	return strings.ToUpper(role[:1]) + role[1:]
+}
+
+// orgEscape protects the lines of a block that org-mode would interpret, by prefixing them with a
+// comma.
+func orgEscape(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if strings.HasPrefix(line, "*") || strings.HasPrefix(line, "#+") ||
+			strings.HasPrefix(line, ",*") || strings.HasPrefix(line, ",#+") {
+			lines[i] = "," + line
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
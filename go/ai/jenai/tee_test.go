@@ -0,0 +1,128 @@
+//nolint:revive
+package jenai
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mooss/jen/go/ai/config"
+	"github.com/mooss/jen/go/ai/models"
+)
+
+func TestTee(t *testing.T) {
+	client := &Client{Model: models.Spec{Provider: "p", Author: "a", Model: "m"}}
+	prompt := Prompt{
+		Name: "explain", Args: []string{"slowly"}, Primary: "Explain this.", Positional: "slowly",
+		Paths: []config.PathInfo{{Path: "main.go", Size: 12, Hash: "abc"}},
+	}
+	answer := []config.Message{{Role: "assistant", Content: "* It is fine."}}
+	conversation := []config.Message{
+		{Role: "user", Content: "Explain this."}, {Role: "assistant", Content: "It is fine."},
+	}
+
+	tests := []struct {
+		name     string
+		tee      config.Tee
+		messages []config.Message
+		expected []string
+	}{
+		{"Markdown answer", config.Tee{File: "out.md"}, answer, []string{
+			"---\ndate: ", "model: p:a/m\nname: explain\nargs:\n    - slowly\n",
+			"prompt: |-\n    Explain this.\n\n    slowly\n", "path: main.go",
+			"estimated_tokens:\n    input: 6\n    output: 4\n---\n\n* It is fine.\n",
+		}},
+		{"Markdown conversation", config.Tee{File: "out.md"}, conversation, []string{
+			"---\n\n## User\n\nExplain this.\n\n## Assistant\n\nIt is fine.\n",
+		}},
+		{"Org from the extension", config.Tee{File: "out.org"}, answer, []string{
+			"* explain [", ":MODEL: p:a/m\n", ":ARGS: slowly\n", ":CONTEXT: main.go\n",
+			":INPUT_TOKENS: 6\n", "** Assistant\n#+begin_src markdown\n,* It is fine.\n#+end_src\n",
+		}},
+		{"Explicit JSON", config.Tee{File: "out.txt", Format: "json"}, conversation, []string{
+			`"name":"explain","args":["slowly"]`, `"estimated_tokens":{"input":4,"output":3}`,
+			`"messages":[{"role":"user","content":"Explain this."}`,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.tee.File = filepath.Join(t.TempDir(), tt.tee.File)
+			if err := client.Tee(tt.tee, prompt, tt.messages); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			data, _ := os.ReadFile(tt.tee.File)
+			for _, expected := range tt.expected {
+				if !strings.Contains(string(data), expected) {
+					t.Errorf("Expected %q in:\n%s", expected, data)
+				}
+			}
+		})
+	}
+}
+
+func TestConversation(t *testing.T) {
+	session := config.SessionMetadata{Dir: t.TempDir(), Name: "chat"}
+	client := &Client{Session: session}
+	if length := client.SessionLength(); length != 0 {
+		t.Errorf("Expected an empty session, got %d messages", length)
+	}
+
+	previous := []config.Message{
+		{Role: "user", Content: "Hi."}, {Role: "assistant", Content: "Hello."},
+	}
+	if err := session.Append("p:a/m", previous...); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	skipped := client.SessionLength()
+	if _, err := client.Conversation(skipped); err == nil {
+		t.Error("Expected an error without new messages")
+	}
+
+	current := []config.Message{
+		{Role: "user", Content: "Why?"}, {Role: "assistant", Content: "Because."},
+	}
+	if err := session.Append("p:a/m", current...); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	messages, err := client.Conversation(skipped)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(messages, current) {
+		t.Errorf("Expected only the messages of the run %+v, got %+v", current, messages)
+	}
+	if tokens := client.Transcript(Prompt{}, messages).Tokens; tokens != (Usage{Input: 1, Output: 2}) {
+		t.Errorf("Expected the tokens of the run, got %+v", tokens)
+	}
+}
+
+func TestTeeAppend(t *testing.T) {
+	client := &Client{}
+	tee := config.Tee{File: filepath.Join(t.TempDir(), "log.jsonl"), Append: true}
+	for _, content := range []string{"first", "second"} {
+		messages := []config.Message{{Role: "assistant", Content: content}}
+		if err := client.Tee(tee, Prompt{Primary: "p"}, messages); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	data, _ := os.ReadFile(tee.File)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected two JSON lines, got:\n%s", data)
+	}
+	for i, line := range lines {
+		var transcript Transcript
+		if err := json.Unmarshal([]byte(line), &transcript); err != nil {
+			t.Fatalf("Invalid JSON line %q: %v", line, err)
+		}
+		if transcript.Messages[0].Content != []string{"first", "second"}[i] {
+			t.Errorf("Unexpected transcript %+v", transcript)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+// Package jsonrpc implements JSON-RPC 2.0 over a stream, with either LSP-style headers or
+// newline-delimited framing.
+package jsonrpc
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mooss/jen/go/ai/errs"
+)
+
+// Standard error codes.
+const (
+	ParseError     = -32700
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	InternalError  = -32603
+)
+
+// Message is a request, a notification or a response.
+// Requests have an ID and a method, notifications only a method and responses only an ID.
+type Message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// IsNotification returns true when the message does not expect a response.
+func (msg Message) IsNotification() bool { return msg.ID == nil && msg.Method != "" }
+
+// Error is a JSON-RPC error object.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string { return fmt.Sprintf("%s (code %d)", e.Message, e.Code) }
+
+// Errorf returns an error with the given code.
+func Errorf(code int, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// toError converts an error returned by a handler to a JSON-RPC error.
+// Input errors are reported as invalid params and the kind of jenai errors is given as data.
+func toError(err error) *Error {
+	var rpcErr *Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr
+	}
+
+	code := InternalError
+	kind := errs.KindOf(err)
+	if kind == errs.Input {
+		code = InvalidParams
+	}
+
+	return &Error{Code: code, Message: err.Error(), Data: map[string]string{"kind": kind.String()}}
+}
+
+/////////////
+// Framing //
+
+// Framing delimits messages in a stream.
+type Framing interface {
+	read(r *bufio.Reader) ([]byte, error)
+	write(w io.Writer, data []byte) error
+}
+
+// MaxMessageSize is the largest content accepted by Headers, in bytes.
+const MaxMessageSize = 64 << 20
+
+// Headers frames messages with a Content-Length header, like the Language Server Protocol.
+type Headers struct{}
+
+func (Headers) read(r *bufio.Reader) ([]byte, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) && len(header) == 0 {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("failed to read headers: %w", err)
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Content-Length header: %w", err)
+	}
+	if length < 0 || length > MaxMessageSize {
+		return nil, fmt.Errorf("invalid Content-Length header: %d is not between 0 and %d",
+			length, MaxMessageSize)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("failed to read %d bytes of content: %w", length, err)
+	}
+
+	return data, nil
+}
+
+func (Headers) write(w io.Writer, data []byte) error {
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(data)); err != nil {
+		return err
+	}
+
+	_, err := w.Write(data)
+	return err
+}
+
+// Lines frames messages by newlines, the JSON content must therefore not contain any.
+type Lines struct{}
+
+func (Lines) read(r *bufio.Reader) ([]byte, error) {
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			return line, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (Lines) write(w io.Writer, data []byte) error {
+	_, err := w.Write(append(data, '\n'))
+	return err
+}
+
+//////////
+// Conn //
+
+// Conn reads and writes messages on a stream.
+// Writes are safe for concurrent use.
+type Conn struct {
+	framing Framing
+	in      *bufio.Reader
+	out     io.Writer
+	mu      sync.Mutex
+}
+
+// NewConn returns a connection reading from in and writing to out.
+func NewConn(in io.Reader, out io.Writer, framing Framing) *Conn {
+	return &Conn{framing: framing, in: bufio.NewReader(in), out: out}
+}
+
+// Read returns the next message, io.EOF when the stream is over.
+func (c *Conn) Read() (Message, error) {
+	data, err := c.framing.read(c.in)
+	if err != nil {
+		return Message{}, err
+	}
+
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return Message{}, Errorf(ParseError, "invalid message: %s", err)
+	}
+
+	return msg, nil
+}
+
+// Write sends a message.
+func (c *Conn) Write(msg Message) error {
+	msg.JSONRPC = "2.0"
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.framing.write(c.out, data)
+}
+
+// Notify sends a notification.
+func (c *Conn) Notify(method string, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(Message{Method: method, Params: data})
+}
+
+// Call sends a request.
+// The response must be read separately, this is meant for clients driving a server in tests.
+func (c *Conn) Call(id int, method string, params any) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	return c.Write(Message{ID: json.RawMessage(strconv.Itoa(id)), Method: method, Params: data})
+}
+
+func (c *Conn) reply(id json.RawMessage, result any, err error) error {
+	if err != nil {
+		return c.Write(Message{ID: id, Error: toError(err)})
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return c.Write(Message{ID: id, Error: toError(err)})
+	}
+
+	return c.Write(Message{ID: id, Result: data})
+}
+
+////////////
+// Server //
+
+// Call is an incoming request or notification.
+type Call struct {
+	// ID is the ID of the request, nil for notifications.
+	ID json.RawMessage
+	// Params are the raw parameters.
+	Params json.RawMessage
+	// Conn is the connection the call came from, to send notifications.
+	Conn *Conn
+}
+
+// Decode unmarshals the parameters, reporting failures as invalid params.
+func (call *Call) Decode(params any) error {
+	if len(call.Params) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(call.Params, params); err != nil {
+		return Errorf(InvalidParams, "invalid params: %s", err)
+	}
+
+	return nil
+}
+
+// Handler answers a call, the result is ignored for notifications.
+type Handler func(ctx context.Context, call *Call) (any, error)
+
+// Server dispatches calls to handlers by method.
+type Server struct {
+	handlers map[string]Handler
+}
+
+func NewServer() *Server { return &Server{handlers: map[string]Handler{}} }
+
+// Handle registers the handler of a method.
+func (srv *Server) Handle(method string, handler Handler) { srv.handlers[method] = handler }
+
+// Serve answers the calls read from conn until the stream is over or ctx is done.
+// Requests are handled concurrently and can be cancelled with $/cancelRequest.
+func (srv *Server) Serve(ctx context.Context, conn *Conn) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		pending = map[string]context.CancelFunc{}
+	)
+	defer wg.Wait()
+
+	for {
+		msg, err := conn.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			var rpcErr *Error
+			if errors.As(err, &rpcErr) {
+				_ = conn.Write(Message{ID: json.RawMessage("null"), Error: rpcErr})
+				continue
+			}
+			return err
+		}
+
+		if msg.Method == "$/cancelRequest" {
+			var params struct{ ID json.RawMessage }
+			_ = json.Unmarshal(msg.Params, &params)
+			mu.Lock()
+			if cancelRequest, exists := pending[string(params.ID)]; exists {
+				cancelRequest()
+			}
+			mu.Unlock()
+			continue
+		}
+
+		if msg.Method == "" { // Responses are not expected by the server.
+			continue
+		}
+
+		handler, exists := srv.handlers[msg.Method]
+		call := &Call{ID: msg.ID, Params: msg.Params, Conn: conn}
+		if msg.IsNotification() {
+			if exists {
+				_, _ = handler(ctx, call)
+			}
+			continue
+		}
+
+		if !exists {
+			_ = conn.reply(msg.ID, nil, Errorf(MethodNotFound, "unknown method: %s", msg.Method))
+			continue
+		}
+
+		reqCtx, cancelRequest := context.WithCancel(ctx)
+		mu.Lock()
+		pending[string(msg.ID)] = cancelRequest
+		mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := handler(reqCtx, call)
+			mu.Lock()
+			delete(pending, string(msg.ID))
+			mu.Unlock()
+			cancelRequest()
+			_ = conn.reply(msg.ID, result, err)
+		}()
+	}
+}
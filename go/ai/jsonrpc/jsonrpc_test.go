@@ -0,0 +1,182 @@
+//nolint:revive
+package jsonrpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// echo answers with its params.
+func echo(_ context.Context, call *Call) (any, error) {
+	return call.Params, nil
+}
+
+// serve runs a server with the echo and wait methods on the input, and returns its responses.
+func serve(t *testing.T, in io.Reader, framing Framing) ([]Message, error) {
+	t.Helper()
+	srv := NewServer()
+	srv.Handle("echo", echo)
+	srv.Handle("wait", func(ctx context.Context, _ *Call) (any, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	var out bytes.Buffer
+	err := srv.Serve(context.Background(), NewConn(in, &out, framing))
+
+	var res []Message
+	conn := NewConn(&out, io.Discard, framing)
+	for {
+		msg, err := conn.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		res = append(res, msg)
+	}
+
+	return res, err
+}
+
+// frame prefixes the content with its Content-Length and the other headers.
+func frame(content, headers string) string {
+	return fmt.Sprintf("Content-Length: %d\r\n%s\r\n%s", len(content), headers, content)
+}
+
+// TestFraming checks the responses, sorted since the requests are handled concurrently.
+func TestFraming(t *testing.T) {
+	tests := []struct {
+		name     string
+		framing  Framing
+		input    string
+		expected []string
+	}{
+		{"Headers", Headers{},
+			frame(`{"jsonrpc":"2.0","id":1,"method":"echo","params":1}`, "") +
+				frame(`{"jsonrpc":"2.0","id":2,"method":"echo","params":"é"}`,
+					"Content-Type: application/json\r\n"),
+			[]string{`{"jsonrpc":"2.0","id":1,"result":1}`,
+				`{"jsonrpc":"2.0","id":2,"result":"é"}`}},
+		{"Lines", Lines{},
+			`{"jsonrpc":"2.0","id":1,"method":"echo","params":1}` + "\n\n  \n" +
+				`{"jsonrpc":"2.0","id":2,"method":"echo","params":[2]}`,
+			[]string{`{"jsonrpc":"2.0","id":1,"result":1}`,
+				`{"jsonrpc":"2.0","id":2,"result":[2]}`}},
+		{"Notification", Lines{},
+			`{"jsonrpc":"2.0","method":"echo","params":1}` + "\n" +
+				`{"jsonrpc":"2.0","id":"a","method":"echo","params":1}` + "\n",
+			[]string{`{"jsonrpc":"2.0","id":"a","result":1}`}},
+		{"Unknown method", Lines{}, `{"jsonrpc":"2.0","id":1,"method":"nope"}` + "\n",
+			[]string{`{"jsonrpc":"2.0","id":1,"error":{"code":-32601,` +
+				`"message":"unknown method: nope"}}`}},
+		{"Invalid JSON", Lines{}, "{\n" + `{"jsonrpc":"2.0","id":1,"method":"echo","params":1}`,
+			[]string{`{"jsonrpc":"2.0","id":1,"result":1}`,
+				`{"jsonrpc":"2.0","id":null,"error":{"code":-32700,` +
+					`"message":"invalid message: unexpected end of JSON input"}}`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, err := serve(t, strings.NewReader(tt.input), tt.framing)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var got []string
+			for _, msg := range messages {
+				data, err := json.Marshal(msg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, string(data))
+			}
+			sort.Strings(got)
+			if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("Expected\n%s\ngot\n%s",
+					strings.Join(tt.expected, "\n"), strings.Join(got, "\n"))
+			}
+		})
+	}
+}
+
+func TestMalformedHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"Missing length", "Content-Type: application/json\r\n\r\n{}", "invalid Content-Length"},
+		{"Invalid length", "Content-Length: two\r\n\r\n{}", "invalid Content-Length"},
+		{"Negative length", "Content-Length: -1\r\n\r\n{}", "not between 0 and"},
+		{"Huge length", "Content-Length: 1099511627776\r\n\r\n{}", "not between 0 and"},
+		{"Short content", "Content-Length: 10\r\n\r\n{}", "failed to read 10 bytes"},
+		{"Invalid header line", "Content-Length 2\r\n\r\n{}", "failed to read headers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			messages, err := serve(t, strings.NewReader(tt.input), Headers{})
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected an error containing %q, got %v", tt.expected, err)
+			}
+			if len(messages) != 0 {
+				t.Errorf("Expected no response, got %+v", messages)
+			}
+		})
+	}
+}
+
+func TestCancelRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		framing Framing
+	}{
+		{"Headers", Headers{}},
+		{"Lines", Lines{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in, client := io.Pipe()
+			conn := NewConn(nil, client, tt.framing)
+			go func() {
+				// The server reads the messages in order, the request is pending when the
+				// cancellation arrives.
+				_ = conn.Call(1, "wait", nil)
+				_ = conn.Call(2, "echo", "done")
+				_ = conn.Notify("$/cancelRequest", map[string]any{"id": 1})
+				_ = conn.Notify("$/cancelRequest", map[string]any{"id": 42}) // Unknown.
+				client.Close()
+			}()
+
+			messages, err := serve(t, in, tt.framing)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(messages) != 2 {
+				t.Fatalf("Expected 2 responses, got %+v", messages)
+			}
+			byID := map[string]Message{}
+			for _, msg := range messages {
+				byID[string(msg.ID)] = msg
+			}
+			if msg := byID["1"]; msg.Error == nil || msg.Error.Code != InternalError ||
+				!strings.Contains(msg.Error.Message, "context canceled") {
+				t.Errorf("Expected the cancelled request to fail, got %+v", msg)
+			}
+			if msg := byID["2"]; string(msg.Result) != `"done"` {
+				t.Errorf("Expected the other request to succeed, got %+v", msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+// Package mapreduce handles inputs too large for a single prompt.
+//
+// The input is split into chunks, a map prompt is run on each chunk concurrently and a reduce
+// prompt merges the partial results. The partial results are themselves reduced in several rounds
+// when they do not fit in the budget.
+package mapreduce
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/mooss/jen/go/ai/errs"
+	"github.com/mooss/jen/go/ai/jenai"
+	"github.com/mooss/jen/go/ai/prompts"
+)
+
+// MapReduce runs a map prompt on the chunks of an input and a reduce prompt on the results.
+type MapReduce struct {
+	// Client sends the final reduce prompt, which is written to its output and recorded in its
+	// session. The other prompts are sent with copies of the client that record nothing.
+	Client *jenai.Client
+	// Map and Reduce are the names of the library prompts run on the chunks and on the results.
+	Map, Reduce string
+	// Budget is the maximum number of tokens of a chunk.
+	Budget int
+	// Boundary starts each file of the input, the chunks are preferably cut before it.
+	Boundary string
+	// Jobs is the number of prompts sent concurrently.
+	Jobs int
+	// Log receives the progress, it can be nil.
+	Log io.Writer
+
+	logMutex sync.Mutex
+}
+
+// Run processes the input according to the task, which can be empty.
+func (mr *MapReduce) Run(ctx context.Context, task, input string) (jenai.Reply, error) {
+	chunks := Split(input, mr.Boundary, mr.Budget)
+	if len(chunks) == 0 {
+		return jenai.Reply{}, errs.InputErr(errors.New("the input is empty"))
+	}
+
+	mapPrompt, err := mr.evaluate(mr.Map)
+	if err != nil {
+		return jenai.Reply{}, err
+	}
+	reducePrompt, err := mr.evaluate(mr.Reduce)
+	if err != nil {
+		return jenai.Reply{}, err
+	}
+
+	mr.logf("Running %s on %d chunks\n", mr.Map, len(chunks))
+	results, err := mr.apply(ctx, "map", mapPrompt, task, chunks)
+	if err != nil {
+		return jenai.Reply{}, err
+	}
+
+	// Reduce the results by groups until they fit in a single prompt.
+	for round := 1; ; round++ {
+		groups := Split(joinResults(results), "", mr.Budget)
+		if len(groups) <= 1 || len(groups) >= len(results) {
+			break // Reducing more would not make progress.
+		}
+
+		mr.logf("Reduce round %d: %d results in %d groups\n", round, len(results), len(groups))
+		if results, err = mr.apply(ctx, "reduce", reducePrompt, task, groups); err != nil {
+			return jenai.Reply{}, err
+		}
+	}
+
+	mr.logf("Final reduce of %d results\n", len(results))
+	return mr.Client.Send(ctx, message(reducePrompt, task, "Partial results", joinResults(results)))
+}
+
+// apply sends the prompt on each chunk concurrently and returns the answers in order.
+func (mr *MapReduce) apply(
+	ctx context.Context, step, prompt, task string, chunks []string,
+) ([]string, error) {
+	client, err := mr.Client.Fork("", "")
+	if err != nil {
+		return nil, err
+	}
+	client.Output = nil
+
+	var (
+		res      = make([]string, len(chunks))
+		failures = make([]error, len(chunks))
+		done     int
+		wg       sync.WaitGroup
+		jobs     = make(chan struct{}, max(mr.Jobs, 1))
+	)
+
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			jobs <- struct{}{}
+			defer func() { <-jobs }()
+
+			part := fmt.Sprintf("Part %d of %d", i+1, len(chunks))
+			reply, err := client.Send(ctx, message(prompt, task, part, chunk))
+			if err != nil {
+				failures[i] = fmt.Errorf("%s of part %d: %w", step, i+1, err)
+				return
+			}
+			res[i] = reply.Content
+
+			mr.logMutex.Lock()
+			done++
+			count := done
+			mr.logMutex.Unlock()
+			mr.logf("%s: %d/%d done\n", step, count, len(chunks))
+		}()
+	}
+	wg.Wait()
+
+	return res, errors.Join(failures...)
+}
+
+// evaluate evaluates the library prompt with the given name.
+func (mr *MapReduce) evaluate(name string) (string, error) {
+	var args []string
+	res, err := prompts.NewEvalContext(mr.Client.Library, &args).Evaluate(name)
+	return res, errs.PromptErr(err)
+}
+
+func (mr *MapReduce) logf(format string, args ...any) {
+	if mr.Log != nil {
+		mr.logMutex.Lock()
+		defer mr.logMutex.Unlock()
+		fmt.Fprintf(mr.Log, format, args...)
+	}
+}
+
+///////////////////////
+// Utility functions //
+
+// message assembles the prompt, the task and a titled content.
+func message(prompt, task, title, content string) string {
+	parts := []string{prompt}
+	if task != "" {
+		parts = append(parts, "# Task\n\n"+task)
+	}
+
+	return strings.Join(append(parts, "# "+title+"\n\n"+content), "\n\n")
+}
+
+func joinResults(results []string) string {
+	var buf strings.Builder
+	for i, result := range results {
+		fmt.Fprintf(&buf, "## Result %d\n\n%s\n\n", i+1, strings.TrimSpace(result))
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,180 @@
+//nolint:revive
+package mapreduce
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mooss/jen/go/ai/config"
+	"github.com/mooss/jen/go/ai/jenai"
+	"github.com/mooss/jen/go/ai/models"
+	"github.com/mooss/jen/go/ai/prompts"
+	"github.com/mooss/jen/go/utils"
+)
+
+func TestSplit(t *testing.T) {
+	fileMarker := config.Framed{}.Boundary()
+	file := func(name, content string) string {
+		return fileMarker + name + " <====\n\n" + content + "\n\n====> END OF " + name + " <===="
+	}
+	paragraph := strings.Repeat("word ", 30) + "\n"
+	longLine := strings.Repeat("é", 500)
+
+	tests := []struct {
+		name   string
+		input  string
+		budget int
+	}{
+		{"Small files packed together", file("a", "alpha") + file("b", "beta"), 100},
+		{"Files on their own", file("a", paragraph) + file("b", paragraph), 60},
+		{"Paragraphs", strings.Repeat(paragraph+"\n", 10), 50},
+		{"Lines", strings.Repeat(paragraph, 10), 50},
+		{"Long line", longLine, 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks := Split(tt.input, fileMarker, tt.budget)
+			if got := strings.Join(chunks, ""); got != tt.input {
+				t.Errorf("Expected the chunks to rebuild the input, got %q", got)
+			}
+
+			for _, chunk := range chunks {
+				if utils.Tokens(chunk) > tt.budget {
+					t.Errorf("Expected chunks under %d tokens, got %d: %q",
+						tt.budget, utils.Tokens(chunk), chunk)
+				}
+			}
+		})
+	}
+
+	if chunks := Split(file("a", "alpha")+file("b", "beta"), fileMarker, 100); len(chunks) != 1 {
+		t.Errorf("Expected small files in a single chunk, got %d", len(chunks))
+	}
+	if chunks := Split(file("a", paragraph)+file("b", paragraph), fileMarker, 60); len(chunks) != 2 ||
+		!strings.HasPrefix(chunks[1], fileMarker+"b") {
+		t.Errorf("Expected a chunk per file, got %q", chunks)
+	}
+}
+
+// counter is a fake model answering with the number of chunks it received.
+type counter struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (c *counter) Send(_ context.Context, req jenai.Request, out io.Writer) (string, error) {
+	c.mutex.Lock()
+	c.messages = append(c.messages, req.Message)
+	c.mutex.Unlock()
+
+	answer := "summary of " + strings.Split(req.Message, "\n# ")[2]
+	_, err := io.WriteString(out, answer)
+	return answer, err
+}
+
+func TestRun(t *testing.T) {
+	lib, err := prompts.Embedded()
+	if err != nil {
+		t.Fatalf("Failed to load embedded prompts: %v", err)
+	}
+
+	backend := &counter{}
+	client := jenai.New(lib, models.Spec{}, config.SessionMetadata{Dir: t.TempDir(), Name: "test"})
+	client.Backend = backend
+	var out, log bytes.Buffer
+	client.Output = &out
+
+	var input strings.Builder
+	for i := range 6 {
+		fmt.Fprintf(&input, "Paragraph %d %s\n\n", i, strings.Repeat("x", 300))
+	}
+
+	mr := &MapReduce{
+		Client: client, Map: "map_summary", Reduce: "reduce_summary", Budget: 100, Jobs: 3, Log: &log,
+	}
+	if _, err := mr.Run(context.Background(), "List the paragraphs.", input.String()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(backend.messages) != 7 {
+		t.Fatalf("Expected 6 maps and a reduce, got %d messages", len(backend.messages))
+	}
+
+	reduce := backend.messages[6]
+	for _, expected := range []string{"# Task\n\nList the paragraphs.", "## Result 6\n\nsummary of"} {
+		if !strings.Contains(reduce, expected) {
+			t.Errorf("Expected the reduce prompt to contain %q, got %q", expected, reduce)
+		}
+	}
+
+	if !strings.HasPrefix(out.String(), "summary of Partial results") {
+		t.Errorf("Expected only the final reduce in the output, got %q", out.String())
+	}
+	if !strings.Contains(log.String(), "map: 6/6 done") {
+		t.Errorf("Expected the progress in the log, got %q", log.String())
+	}
+}
+
+// TestRunFormats checks that the chunks are cut between the files in every context format.
+func TestRunFormats(t *testing.T) {
+	lib, err := prompts.Embedded()
+	if err != nil {
+		t.Fatalf("Failed to load embedded prompts: %v", err)
+	}
+
+	names := []string{"alpha", "bravo", "charlie"}
+	mapPart := regexp.MustCompile(`\n# Part \d of 3\n`) // The reduce prompts have fewer parts.
+	var sections []config.Section
+	for _, name := range names {
+		paragraph := strings.Repeat(name+" ", 8) + "\n"
+		sections = append(sections, config.Section{
+			Name: name + ".txt", Path: name + ".txt", Content: paragraph + "\n" + paragraph,
+		})
+	}
+
+	for _, format := range []string{"framed", "json", "markdown", "xml"} {
+		t.Run(format, func(t *testing.T) {
+			renderer := config.Renderers[format]
+			backend := &counter{}
+			client := jenai.New(lib, models.Spec{}, config.SessionMetadata{})
+			client.Backend = backend
+
+			mr := &MapReduce{
+				Client: client, Map: "map_summary", Reduce: "reduce_summary", Budget: 60,
+				Boundary: renderer.Boundary(), Jobs: 1,
+			}
+			task := "Summarize the files."
+			if _, err := mr.Run(context.Background(), task, renderer.Render(sections)); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var maps []string
+			for _, message := range backend.messages {
+				if mapPart.MatchString(message) {
+					maps = append(maps, message)
+				}
+			}
+			if len(maps) != len(names) {
+				t.Fatalf("Expected a chunk per file, got %d chunks", len(maps))
+			}
+			for _, message := range maps {
+				var found []string
+				for _, name := range names {
+					if strings.Contains(message, name) {
+						found = append(found, name)
+					}
+				}
+				if len(found) != 1 {
+					t.Errorf("Expected a single file per chunk, got %v in %q", found, message)
+				}
+			}
+		})
+	}
+}
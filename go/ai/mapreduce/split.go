@@ -0,0 +1,85 @@
+package mapreduce
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/mooss/jen/go/utils"
+)
+
+// Split splits the input into chunks of at most budget tokens.
+// The input is cut before each boundary first, which starts the files of the context, then on
+// paragraphs, then on lines. A single line exceeding the budget is cut arbitrarily.
+// An empty boundary does not cut anything.
+func Split(input, boundary string, budget int) []string {
+	var (
+		res     []string
+		current string
+	)
+
+	for _, unit := range units(input, boundary, budget) {
+		if current != "" && utils.Tokens(current+unit) > budget {
+			res = append(res, current)
+			current = ""
+		}
+		current += unit
+	}
+
+	if strings.TrimSpace(current) != "" {
+		res = append(res, current)
+	}
+
+	return res
+}
+
+// units cuts the input into pieces of at most budget tokens, on the coarsest boundaries possible.
+// Concatenating the units gives back the input.
+func units(input, boundary string, budget int) []string {
+	files := []string{input}
+	if boundary != "" {
+		files = utils.SplitBefore(input, boundary)
+	}
+
+	var res []string
+	for _, file := range files {
+		for _, paragraph := range fitting(file, "\n\n", budget) {
+			for _, line := range fitting(paragraph, "\n", budget) {
+				res = append(res, cut(line, budget*4)...)
+			}
+		}
+	}
+
+	return res
+}
+
+// fitting returns the text whole when it fits in the budget, or split after each separator.
+func fitting(text, separator string, budget int) []string {
+	if utils.Tokens(text) <= budget {
+		return []string{text}
+	}
+
+	var res []string
+	for _, part := range strings.SplitAfter(text, separator) {
+		if part != "" {
+			res = append(res, part)
+		}
+	}
+
+	return res
+}
+
+// cut cuts the text in pieces of at most size bytes, without splitting runes.
+func cut(text string, size int) []string {
+	var res []string
+	for len(text) > size {
+		end := size
+		for end > 1 && !utf8.RuneStart(text[end]) {
+			end--
+		}
+
+		res = append(res, text[:end])
+		text = text[end:]
+	}
+
+	return append(res, text)
+}
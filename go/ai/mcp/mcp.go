@@ -0,0 +1,194 @@
+// Package mcp implements a Model Context Protocol server over stdio.
+// It publishes the prompts of the library as MCP prompts and the context gathering tools as MCP
+// tools.
+package mcp
+
+import (
+	"context"
+	"io"
+	"maps"
+	"slices"
+
+	"github.com/mooss/jen/go/ai/config"
+	"github.com/mooss/jen/go/ai/jsonrpc"
+	"github.com/mooss/jen/go/ai/prompts"
+	"github.com/mooss/jen/go/ai/secrets"
+	"github.com/mooss/jen/go/ai/tools"
+)
+
+// ProtocolVersion is the version of the protocol implemented by the server.
+const ProtocolVersion = "2025-06-18"
+
+// supportedVersions are the protocol versions accepted from clients.
+var supportedVersions = []string{"2024-11-05", "2025-03-26", ProtocolVersion}
+
+// Server publishes prompts and tools.
+type Server struct {
+	// Library is the source of the prompts.
+	Library prompts.Library
+	// Tools are the tools that can be called.
+	Tools tools.Set
+	// Secrets decides what happens to the tool outputs containing secrets, blocked by default.
+	Secrets secrets.Policy
+}
+
+// New returns a server publishing the library and the tools.
+func New(lib prompts.Library, set tools.Set) *Server {
+	return &Server{Library: lib, Tools: set}
+}
+
+// Serve answers the requests read from in until it is exhausted.
+func (srv *Server) Serve(ctx context.Context, in io.Reader, out io.Writer) error {
+	rpc := jsonrpc.NewServer()
+	rpc.Handle("initialize", srv.initialize)
+	rpc.Handle("ping", func(context.Context, *jsonrpc.Call) (any, error) { return struct{}{}, nil })
+	rpc.Handle("prompts/list", srv.listPrompts)
+	rpc.Handle("prompts/get", srv.getPrompt)
+	rpc.Handle("tools/list", srv.listTools)
+	rpc.Handle("tools/call", srv.callTool)
+
+	return rpc.Serve(ctx, jsonrpc.NewConn(in, out, jsonrpc.Lines{}))
+}
+
+////////////////////
+// Initialization //
+
+func (*Server) initialize(_ context.Context, call *jsonrpc.Call) (any, error) {
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if err := call.Decode(&params); err != nil {
+		return nil, err
+	}
+
+	// Answer with the version of the client when supported, with the latest one otherwise.
+	version := ProtocolVersion
+	if slices.Contains(supportedVersions, params.ProtocolVersion) {
+		version = params.ProtocolVersion
+	}
+
+	return map[string]any{
+		"protocolVersion": version,
+		"serverInfo":      map[string]string{"name": "jenai", "version": "0"},
+		"capabilities": map[string]any{
+			"prompts": map[string]any{},
+			"tools":   map[string]any{},
+		},
+	}, nil
+}
+
+/////////////
+// Prompts //
+
+// Prompt describes a prompt.
+type Prompt struct {
+	Name      string     `json:"name"`
+	Arguments []Argument `json:"arguments,omitempty"`
+}
+
+// Argument describes an argument of a prompt.
+type Argument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+// Message is a message of a rendered prompt.
+type Message struct {
+	Role    string  `json:"role"`
+	Content Content `json:"content"`
+}
+
+// Content is a textual content.
+type Content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func text(content string) Content { return Content{Type: "text", Text: content} }
+
+func (srv *Server) listPrompts(context.Context, *jsonrpc.Call) (any, error) {
+	res := []Prompt{}
+	for _, name := range slices.Sorted(maps.Keys(srv.Library.Prompts)) {
+		prompt := Prompt{Name: name}
+		for _, param := range srv.Library.Parameters[name] {
+			prompt.Arguments = append(prompt.Arguments,
+				Argument{Name: param.Name, Description: param.Description, Required: param.Required})
+		}
+		res = append(res, prompt)
+	}
+
+	return map[string]any{"prompts": res}, nil
+}
+
+func (srv *Server) getPrompt(_ context.Context, call *jsonrpc.Call) (any, error) {
+	var params struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments"`
+	}
+	if err := call.Decode(&params); err != nil {
+		return nil, err
+	}
+
+	if _, err := srv.Library.RawPrompt(params.Name); err != nil {
+		return nil, jsonrpc.Errorf(jsonrpc.InvalidParams, "%s", err)
+	}
+
+	args, err := srv.Library.Positional(params.Name, params.Arguments)
+	if err != nil {
+		return nil, jsonrpc.Errorf(jsonrpc.InvalidParams, "%s", err)
+	}
+
+	prompt, err := config.Options{Name: params.Name, Args: args}.Build(srv.Library)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{
+		"messages": []Message{{Role: "user", Content: text(prompt.String())}},
+	}, nil
+}
+
+///////////
+// Tools //
+
+// Tool describes a tool.
+type Tool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"inputSchema"`
+}
+
+func (srv *Server) listTools(context.Context, *jsonrpc.Call) (any, error) {
+	res := []Tool{}
+	for _, tool := range srv.Tools.Sorted() {
+		res = append(res, Tool{tool.Name, tool.Description, tool.Schema()})
+	}
+
+	return map[string]any{"tools": res}, nil
+}
+
+func (srv *Server) callTool(ctx context.Context, call *jsonrpc.Call) (any, error) {
+	var params struct {
+		Name      string     `json:"name"`
+		Arguments tools.Args `json:"arguments"`
+	}
+	if err := call.Decode(&params); err != nil {
+		return nil, err
+	}
+
+	if _, exists := srv.Tools[params.Name]; !exists {
+		return nil, jsonrpc.Errorf(jsonrpc.InvalidParams, "unknown tool: %s", params.Name)
+	}
+
+	// Tool failures are reported in the result so that the model can see them.
+	output, err := srv.Tools.Call(ctx, params.Name, params.Arguments)
+	if err == nil {
+		output, err = srv.Secrets.Apply(output)
+	}
+	if err != nil {
+		return map[string]any{"content": []Content{text(err.Error())}, "isError": true}, nil
+	}
+
+	return map[string]any{"content": []Content{text(output)}, "isError": false}, nil
+}
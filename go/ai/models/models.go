@@ -4,7 +4,10 @@ package models
 import (
 	_ "embed"
 	"fmt"
+	"slices"
+	"strings"
 
+	"github.com/mooss/jen/go/ai/errs"
 	"github.com/mooss/jen/go/utils"
 )
 
@@ -20,8 +23,20 @@ type Spec struct {
 	Author    string `yaml:"author"`
 	// Model identifier, e.g., "deepseek-r1-0528:nitro".
 	Model     string `yaml:"model"`
+	// Capabilities of the model beyond text, e.g., "vision".
+	Capabilities []string `yaml:"capabilities"`
+	// ContextFormat is the framing of the context that suits the model best, e.g., "xml".
+	ContextFormat string `yaml:"context_format"`
 }
 
+// Capabilities that models can declare.
+const (
+	// Vision is the ability to read images.
+	Vision = "vision"
+	// Tools is the ability to call tools natively.
+	Tools = "tools"
+)
+
 type Zoo struct {
 	Models map[string]Spec `yaml:"models"`
 }
@@ -44,10 +59,12 @@ func FromYAML(data []byte) (map[string]Spec, error) {
 
 // ModelSpecs returns the map of model short names to their specifications.
 func ModelSpecs() (map[string]Spec, error) {
-	return loadModels()
+	specs, err := loadModels()
+	return specs, errs.ConfigErr(err)
 }
 
 // Get returns the specification for the given short name.
+// An unknown name is an input error.
 func Get(shortName string) (Spec, error) {
 	specs, err := ModelSpecs()
 	if err != nil {
@@ -55,11 +72,59 @@ func Get(shortName string) (Spec, error) {
 	}
 	spec, ok := specs[shortName]
 	if !ok {
-		return Spec{}, fmt.Errorf("unknown model: %s", shortName)
+		return Spec{}, errs.InputErr(fmt.Errorf("unknown model: %s", shortName))
 	}
 	return spec, nil
 }
 
+// Resolve returns the specification of a model given either its short name or its full name in
+// aichat's provider:author/model format.
+func Resolve(name string) (Spec, error) {
+	provider, rest, found := strings.Cut(name, ":")
+	if !found {
+		return Get(name)
+	}
+
+	author, model, found := strings.Cut(rest, "/")
+	if !found {
+		return Get(name)
+	}
+
+	res := Spec{Provider: provider, Author: author, Model: model}
+	specs, _ := ModelSpecs() // A full name is usable even without the settings of the zoo.
+	for _, spec := range specs {
+		// The settings of known models are kept when they are designated by their full name.
+		if spec.Aichat() == res.Aichat() {
+			res.Capabilities, res.ContextFormat = spec.Capabilities, spec.ContextFormat
+		}
+	}
+
+	return res, nil
+}
+
+// Has returns true when the model declares the capability.
+func (sp Spec) Has(capability string) bool {
+	return slices.Contains(sp.Capabilities, capability)
+}
+
+// WithCapability returns the sorted short names of the models declaring the capability.
+func WithCapability(capability string) ([]string, error) {
+	specs, err := ModelSpecs()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []string
+	for short, spec := range specs {
+		if spec.Has(capability) {
+			res = append(res, short)
+		}
+	}
+	slices.Sort(res)
+
+	return res, nil
+}
+
 // Aichat returns the model name as aichat's --model flag expects it.
 func (sp Spec) Aichat() string {
 	return fmt.Sprintf("%s:%s/%s", sp.Provider, sp.Author, sp.Model)
@@ -0,0 +1,70 @@
+//nolint:revive
+package models
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/mooss/jen/go/ai/errs"
+)
+
+func TestCapabilities(t *testing.T) {
+	tests := []struct {
+		name   string
+		model  string
+		vision bool
+	}{
+		{"Short name", "gem25f", true},
+		{"Short name without vision", "ds3.2", false},
+		{"Full name of a known model", "openrouter:google/gemini-2.5-flash", true},
+		{"Unknown full name", "openrouter:acme/model", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, err := Resolve(tt.model)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if spec.Has(Vision) != tt.vision {
+				t.Errorf("Expected vision to be %v for %s", tt.vision, tt.model)
+			}
+		})
+	}
+
+	capable, err := WithCapability(Vision)
+	if err != nil || len(capable) == 0 {
+		t.Errorf("Expected models with vision, got %v, %v", capable, err)
+	}
+}
+
+func TestUnknownModel(t *testing.T) {
+	tests := []string{"nope", "openrouter-without-model"}
+
+	for _, model := range tests {
+		t.Run(model, func(t *testing.T) {
+			_, err := Resolve(model)
+			if kind := errs.KindOf(err); kind != errs.Input {
+				t.Errorf("Expected an input error, got %v (%v)", kind, err)
+			}
+		})
+	}
+}
+
+func TestBrokenZoo(t *testing.T) {
+	original := loadModels
+	loadModels = func() (map[string]Spec, error) { return nil, errors.New("broken zoo") }
+	t.Cleanup(func() { loadModels = original })
+
+	spec, err := Resolve("openrouter:google/gemini-2.5-flash")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if spec.Aichat() != "openrouter:google/gemini-2.5-flash" || spec.Has(Vision) {
+		t.Errorf("Expected the full name to pass through without settings, got %+v", spec)
+	}
+
+	if _, err := Resolve("gem25f"); errs.KindOf(err) != errs.Config {
+		t.Errorf("Expected a config error for a short name, got %v", err)
+	}
+}
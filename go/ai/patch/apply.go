@@ -0,0 +1,304 @@
+package patch
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mooss/jen/go/utils"
+)
+
+// Change is the validated change of a file: its content before and after the patch.
+type Change struct {
+	File *File
+	Old  string
+	New  string
+	// Created is true when the file does not exist yet.
+	Created bool
+}
+
+// Validate computes the changes of the patch against the working tree rooted at root, without
+// writing anything.
+// The returned error reports every file that the patch cannot be applied to.
+func (p *Patch) Validate(root string) ([]Change, error) {
+	var (
+		res  []Change
+		errs []error
+	)
+
+	for _, file := range p.Files {
+		change, err := file.change(root)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", file.Path, err))
+			continue
+		}
+		res = append(res, change)
+	}
+
+	return res, errors.Join(errs...)
+}
+
+// Apply writes the changes to the working tree rooted at root.
+func Apply(root string, changes []Change) error {
+	for _, change := range changes {
+		path := filepath.Join(root, change.File.Path)
+		if change.File.Delete {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+
+		mode := fs.FileMode(0644)
+		if info, err := os.Stat(path); err == nil {
+			mode = info.Mode().Perm()
+		}
+
+		if err := os.WriteFile(path, []byte(change.New), mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stage adds the changed files to the git index.
+func Stage(root string, changes []Change) error {
+	args := []string{"add", "--all", "--"}
+	for _, change := range changes {
+		args = append(args, change.File.Path)
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = root
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git add failed: %w:\n%s", err, output)
+	}
+
+	return nil
+}
+
+// change computes the change of the file.
+func (file *File) change(root string) (Change, error) {
+	if filepath.IsAbs(file.Path) || !filepath.IsLocal(file.Path) {
+		return Change{}, errors.New("the path must be relative and inside the working tree")
+	}
+	if err := utils.InTree(root, file.Path); err != nil {
+		return Change{}, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(root, file.Path))
+	exists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return Change{}, err
+	}
+
+	switch {
+	case file.Create && exists:
+		return Change{}, errors.New("the file to create already exists")
+	case !file.Create && !exists && len(file.Hunks) > 0:
+		return Change{}, errors.New("the file does not exist")
+	case file.Delete && !exists:
+		return Change{}, errors.New("the file to delete does not exist")
+	}
+
+	res := Change{File: file, Old: string(data), Created: !exists}
+	if len(file.Blocks) > 0 {
+		res.New, err = applyBlocks(res.Old, file.Blocks, exists)
+	} else {
+		res.New, err = applyHunks(res.Old, file.Hunks)
+	}
+
+	return res, err
+}
+
+/////////////////
+// Application //
+
+// applyHunks applies the hunks in order.
+// A hunk is searched at the position announced by its header, and then at increasing distances
+// from it to tolerate imprecise line numbers.
+func applyHunks(content string, hunks []Hunk) (string, error) {
+	lines, trailingNewline := splitLines(content)
+	offset := 0 // Shift introduced by the previous hunks.
+	minimum := 0
+
+	for i, hunk := range hunks {
+		var old, replacement []string
+		for _, line := range hunk.Lines {
+			if line.Kind != '+' {
+				old = append(old, line.Text)
+			}
+			if line.Kind != '-' {
+				replacement = append(replacement, line.Text)
+			}
+		}
+
+		base := max(hunk.OldStart-1, 0)
+		if hunk.OldLines == 0 { // Pure insertion, the header points to the line before.
+			base = hunk.OldStart
+		}
+
+		position, found := locate(lines, old, base+offset, minimum)
+		if !found {
+			return "", fmt.Errorf(
+				"hunk %d (line %d of the answer) does not match the file near line %d",
+				i+1, hunk.Line, hunk.OldStart)
+		}
+
+		lines = append(lines[:position], append(replacement, lines[position+len(old):]...)...)
+		// Later hunks are likely to be shifted in the same way as this one.
+		offset = position - base + len(replacement) - len(old)
+		minimum = position + len(replacement)
+	}
+
+	return joinLines(lines, trailingNewline || content == ""), nil
+}
+
+// locate returns the position of needle in lines closest to expected, not before minimum.
+func locate(lines, needle []string, expected, minimum int) (int, bool) {
+	expected = min(max(expected, minimum), len(lines))
+	for distance := 0; distance <= len(lines); distance++ {
+		for _, position := range []int{expected - distance, expected + distance} {
+			if position >= minimum && position+len(needle) <= len(lines) &&
+				equalLines(lines[position:position+len(needle)], needle) {
+				return position, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+// equalLines compares lines, ignoring trailing whitespace.
+func equalLines(a, b []string) bool {
+	for i := range a {
+		if strings.TrimRight(a[i], " \t") != strings.TrimRight(b[i], " \t") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// applyBlocks replaces the search text of each block, which must appear exactly once.
+// A single block with an empty search text creates a file that does not exist.
+func applyBlocks(content string, blocks []Block, exists bool) (string, error) {
+	if !exists {
+		if len(blocks) != 1 || blocks[0].Search != "" {
+			return "", errors.New(
+				"the file does not exist (use a single empty search block to create it)")
+		}
+
+		return blocks[0].Replace + "\n", nil
+	}
+
+	for i, block := range blocks {
+		if block.Search == "" {
+			return "", fmt.Errorf("block %d (line %d of the answer) has an empty search text",
+				i+1, block.Line)
+		}
+
+		switch count := strings.Count(content, block.Search); count {
+		case 1:
+			content = strings.Replace(content, block.Search, block.Replace, 1)
+		case 0:
+			return "", fmt.Errorf("block %d (line %d of the answer): search text not found",
+				i+1, block.Line)
+		default:
+			return "", fmt.Errorf("block %d (line %d of the answer): search text found %d times",
+				i+1, block.Line, count)
+		}
+	}
+
+	return content, nil
+}
+
+func splitLines(content string) ([]string, bool) {
+	if content == "" {
+		return nil, false
+	}
+
+	trailing := strings.HasSuffix(content, "\n")
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n"), trailing
+}
+
+func joinLines(lines []string, trailingNewline bool) string {
+	res := strings.Join(lines, "\n")
+	if trailingNewline && len(lines) > 0 {
+		res += "\n"
+	}
+
+	return res
+}
+
+/////////////
+// Preview //
+
+// ANSI escape sequences used by the preview.
+const (
+	bold  = "\033[1m"
+	red   = "\033[31m"
+	green = "\033[32m"
+	cyan  = "\033[36m"
+	reset = "\033[0m"
+)
+
+// Preview writes a summary of the changes, colored when color is true.
+func Preview(w io.Writer, changes []Change, color bool) {
+	paint := func(code, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + reset
+	}
+
+	for _, change := range changes {
+		file := change.File
+		status := "modify"
+		switch {
+		case file.Delete:
+			status = "delete"
+		case change.Created:
+			status = "create"
+		}
+		fmt.Fprintln(w, paint(bold, fmt.Sprintf("%s %s", status, file.Path)))
+
+		for _, hunk := range file.Hunks {
+			fmt.Fprintln(w, paint(cyan, fmt.Sprintf("@@ -%d,%d +%d,%d @@",
+				hunk.OldStart, hunk.OldLines, hunk.NewStart, hunk.NewLines)))
+			for _, line := range hunk.Lines {
+				text := string(line.Kind) + line.Text
+				switch line.Kind {
+				case '-':
+					text = paint(red, text)
+				case '+':
+					text = paint(green, text)
+				}
+				fmt.Fprintln(w, text)
+			}
+		}
+
+		for _, block := range file.Blocks {
+			fmt.Fprintln(w, paint(cyan, "@@ search/replace @@"))
+			for _, line := range strings.Split(block.Search, "\n") {
+				if block.Search != "" {
+					fmt.Fprintln(w, paint(red, "-"+line))
+				}
+			}
+			for _, line := range strings.Split(block.Replace, "\n") {
+				fmt.Fprintln(w, paint(green, "+"+line))
+			}
+		}
+		fmt.Fprintln(w)
+	}
+}
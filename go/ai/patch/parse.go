@@ -0,0 +1,338 @@
+// Package patch turns model answers into file edits.
+// Two formats are supported: unified diffs and search/replace blocks.
+//
+// A search/replace block is introduced by the path of the file on its own line:
+//
+//	path/to/file.go
+//	<<<<<<< SEARCH
+//	exact lines to find
+//	=======
+//	lines replacing them
+//	>>>>>>> REPLACE
+package patch
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Patch is a set of changes to files.
+type Patch struct {
+	Files []*File
+}
+
+// File is the set of changes to a single file.
+// It is made either of hunks or of blocks.
+type File struct {
+	// Path is the path of the file, relative to the root of the working tree.
+	Path string
+	// Create is true when the file is created.
+	Create bool
+	// Delete is true when the file is deleted.
+	Delete bool
+	// Hunks are the hunks of a unified diff.
+	Hunks []Hunk
+	// Blocks are search/replace blocks.
+	Blocks []Block
+}
+
+// Hunk is a hunk of a unified diff.
+type Hunk struct {
+	// Line is the line of the hunk header in the answer, for error reporting.
+	Line               int
+	OldStart, OldLines int
+	NewStart, NewLines int
+	Lines              []Line
+}
+
+// Line is a line of a hunk.
+type Line struct {
+	// Kind is ' ' for context, '-' for removal and '+' for addition.
+	Kind byte
+	Text string
+}
+
+// Block is a search/replace block.
+type Block struct {
+	// Line is the line of the SEARCH marker in the answer, for error reporting.
+	Line    int
+	Search  string
+	Replace string
+}
+
+// ParseError is an error located in the answer.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string { return fmt.Sprintf("line %d: %s", e.Line, e.Msg) }
+
+func errorf(line int, format string, args ...any) *ParseError {
+	return &ParseError{Line: line, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Markers of search/replace blocks.
+const (
+	searchMarker  = "<<<<<<< SEARCH"
+	dividerMarker = "======="
+	replaceMarker = ">>>>>>> REPLACE"
+)
+
+// Parse extracts the patch from a model answer.
+// Search/replace blocks take precedence over unified diffs when both are present.
+func Parse(answer string) (*Patch, error) {
+	lines := strings.Split(strings.ReplaceAll(answer, "\r\n", "\n"), "\n")
+
+	var (
+		res *Patch
+		err error
+	)
+	if containsLine(lines, searchMarker) {
+		res, err = parseBlocks(lines)
+	} else {
+		res, err = parseUnified(lines)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	if len(res.Files) == 0 {
+		return nil, fmt.Errorf("no unified diff nor search/replace block found in the answer")
+	}
+
+	return res, nil
+}
+
+// Paths returns the paths of the files changed by the patch.
+func (p *Patch) Paths() []string {
+	res := make([]string, 0, len(p.Files))
+	for _, file := range p.Files {
+		res = append(res, file.Path)
+	}
+
+	return res
+}
+
+//////////////////
+// Unified diff //
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// Sections changing the same file are merged, their hunks being sorted by position.
+func parseUnified(lines []string) (*Patch, error) {
+	res := &Patch{}
+	var current *File
+	byPath := map[string]*File{}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "--- "):
+			if i+1 >= len(lines) || !strings.HasPrefix(lines[i+1], "+++ ") {
+				return nil, errorf(i+1, "file header %q is not followed by a +++ header", line)
+			}
+
+			file := newFile(line[4:], lines[i+1][4:])
+			if existing, exists := byPath[file.Path]; exists {
+				if existing.Create != file.Create || existing.Delete != file.Delete {
+					return nil, errorf(i+1, "%s is both changed and created or deleted", file.Path)
+				}
+				file = existing
+			} else {
+				byPath[file.Path] = file
+				res.Files = append(res.Files, file)
+			}
+			current = file
+			i++
+
+		case strings.HasPrefix(line, "@@"):
+			if current == nil {
+				return nil, errorf(i+1, "hunk header %q is not preceded by file headers", line)
+			}
+
+			hunk, next, err := parseHunk(lines, i)
+			if err != nil {
+				return nil, err
+			}
+
+			current.Hunks = append(current.Hunks, hunk)
+			i = next - 1
+		}
+	}
+
+	for _, file := range res.Files {
+		if len(file.Hunks) == 0 {
+			return nil, fmt.Errorf("no hunk for %s", file.Path)
+		}
+		sort.SliceStable(file.Hunks, func(i, j int) bool {
+			return file.Hunks[i].OldStart < file.Hunks[j].OldStart
+		})
+	}
+
+	return res, nil
+}
+
+// newFile returns a file from the paths of its --- and +++ headers.
+func newFile(oldPath, newPath string) *File {
+	oldPath, newPath = headerPath(oldPath), headerPath(newPath)
+	if newPath == "/dev/null" {
+		return &File{Path: strings.TrimPrefix(oldPath, "a/"), Delete: true}
+	}
+
+	return &File{Path: strings.TrimPrefix(newPath, "b/"), Create: oldPath == "/dev/null"}
+}
+
+// headerPath removes the timestamp that can follow the path in a file header.
+func headerPath(path string) string {
+	path, _, _ = strings.Cut(path, "\t")
+	return strings.TrimSpace(path)
+}
+
+// parseHunk parses the hunk starting at lines[start].
+// Returns the index of the line following the hunk.
+func parseHunk(lines []string, start int) (Hunk, int, error) {
+	match := hunkHeader.FindStringSubmatch(lines[start])
+	if match == nil {
+		return Hunk{}, 0, errorf(start+1, "malformed hunk header %q", lines[start])
+	}
+
+	hunk := Hunk{
+		Line:     start + 1,
+		OldStart: atoi(match[1], 0),
+		OldLines: atoi(match[2], 1),
+		NewStart: atoi(match[3], 0),
+		NewLines: atoi(match[4], 1),
+	}
+
+	old, added := 0, 0
+	i := start + 1
+	for ; i < len(lines) && (old < hunk.OldLines || added < hunk.NewLines); i++ {
+		line := lines[i]
+		if line == "" {
+			if i == len(lines)-1 { // End of the answer.
+				break
+			}
+			line = " " // Trailing whitespace is often stripped from empty context lines.
+		}
+
+		kind := line[0]
+		switch kind {
+		case ' ':
+			old++
+			added++
+		case '-':
+			old++
+		case '+':
+			added++
+		case '\\': // No newline at end of file.
+			continue
+		default:
+			return Hunk{}, 0, errorf(i+1,
+				"unexpected line %q in hunk at line %d (%d/%d old and %d/%d new lines read)",
+				lines[i], hunk.Line, old, hunk.OldLines, added, hunk.NewLines)
+		}
+
+		hunk.Lines = append(hunk.Lines, Line{Kind: kind, Text: line[1:]})
+	}
+
+	if old != hunk.OldLines || added != hunk.NewLines {
+		return Hunk{}, 0, errorf(hunk.Line,
+			"hunk announces %d old and %d new lines but contains %d old and %d new lines",
+			hunk.OldLines, hunk.NewLines, old, added)
+	}
+
+	return hunk, i, nil
+}
+
+func atoi(value string, def int) int {
+	if value == "" {
+		return def
+	}
+
+	res, err := strconv.Atoi(value)
+	if err != nil {
+		return def
+	}
+
+	return res
+}
+
+/////////////////////////////
+// Search/replace blocks //
+
+func parseBlocks(lines []string) (*Patch, error) {
+	res := &Patch{}
+	byPath := map[string]*File{}
+
+	for i := 0; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) != searchMarker {
+			continue
+		}
+
+		path := blockPath(lines, i)
+		if path == "" {
+			return nil, errorf(i+1, "search block without a file path on the preceding line")
+		}
+
+		block := Block{Line: i + 1}
+		divider := findLine(lines, i+1, dividerMarker, searchMarker, replaceMarker)
+		if divider < 0 || strings.TrimSpace(lines[divider]) != dividerMarker {
+			return nil, errorf(i+1, "search block for %s is not followed by %q", path, dividerMarker)
+		}
+
+		end := findLine(lines, divider+1, replaceMarker, searchMarker, dividerMarker)
+		if end < 0 || strings.TrimSpace(lines[end]) != replaceMarker {
+			return nil, errorf(divider+1, "replace block for %s is not terminated by %q",
+				path, replaceMarker)
+		}
+
+		block.Search = strings.Join(lines[i+1:divider], "\n")
+		block.Replace = strings.Join(lines[divider+1:end], "\n")
+
+		file, exists := byPath[path]
+		if !exists {
+			file = &File{Path: path}
+			byPath[path] = file
+			res.Files = append(res.Files, file)
+		}
+		file.Blocks = append(file.Blocks, block)
+		i = end
+	}
+
+	return res, nil
+}
+
+// blockPath returns the path preceding the search marker at lines[marker], skipping code fences.
+func blockPath(lines []string, marker int) string {
+	for i := marker - 1; i >= 0; i-- {
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "```") {
+			continue
+		}
+
+		return strings.Trim(line, "`*: ")
+	}
+
+	return ""
+}
+
+// findLine returns the index of the first line from start equal to one of the markers, -1 if none.
+func findLine(lines []string, start int, markers ...string) int {
+	for i := start; i < len(lines); i++ {
+		for _, marker := range markers {
+			if strings.TrimSpace(lines[i]) == marker {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+func containsLine(lines []string, marker string) bool {
+	return findLine(lines, 0, marker) >= 0
+}
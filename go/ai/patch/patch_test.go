@@ -0,0 +1,187 @@
+//nolint:revive
+package patch
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const original = `package main
+
+func main() {
+	println("hello")
+}
+
+func other() {}
+`
+
+func newTree(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "main.go"), []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return root
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   string
+		path     string
+		expected string
+	}{
+		{
+			"Unified diff in a fence",
+			"Here you go:\n```diff\n--- a/main.go\n+++ b/main.go\n@@ -3,3 +3,3 @@\n func main() {\n-\tprintln(\"hello\")\n+\tprintln(\"bye\")\n }\n```\n",
+			"main.go",
+			strings.Replace(original, "hello", "bye", 1),
+		},
+		{
+			"Imprecise line numbers",
+			"--- a/main.go\n+++ b/main.go\n@@ -1,1 +1,2 @@\n func other() {}\n+func added() {}\n",
+			"main.go",
+			original + "func added() {}\n",
+		},
+		{
+			"Sections of the same file merged",
+			"--- a/main.go\n+++ b/main.go\n@@ -7,1 +7,1 @@\n-func other() {}\n+func other2() {}\n" +
+				"--- a/main.go\n+++ b/main.go\n@@ -3,3 +3,3 @@\n func main() {\n-\tprintln(\"hello\")\n" +
+				"+\tprintln(\"bye\")\n }\n",
+			"main.go",
+			strings.NewReplacer("hello", "bye", "other", "other2").Replace(original),
+		},
+		{
+			"New file",
+			"--- /dev/null\n+++ b/dir/new.txt\n@@ -0,0 +1,2 @@\n+first\n+second\n",
+			"dir/new.txt",
+			"first\nsecond\n",
+		},
+		{
+			"Search/replace",
+			"main.go\n```go\n<<<<<<< SEARCH\n\tprintln(\"hello\")\n=======\n\tprintln(\"hi\")\n\tprintln(\"there\")\n>>>>>>> REPLACE\n```\n",
+			"main.go",
+			strings.Replace(original, "\tprintln(\"hello\")", "\tprintln(\"hi\")\n\tprintln(\"there\")", 1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := newTree(t)
+			p, err := Parse(tt.answer)
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+
+			changes, err := p.Validate(root)
+			if err != nil {
+				t.Fatalf("Failed to validate: %v", err)
+			}
+
+			if err := Apply(root, changes); err != nil {
+				t.Fatalf("Failed to apply: %v", err)
+			}
+
+			data, err := os.ReadFile(filepath.Join(root, tt.path))
+			if err != nil {
+				t.Fatalf("Failed to read result: %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("Expected:\n%s\nGot:\n%s", tt.expected, data)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   string
+		expected string
+	}{
+		{"Nothing", "No changes needed.", "no unified diff nor search/replace block"},
+		{"Wrong counts", "--- a/main.go\n+++ b/main.go\n@@ -3,4 +3,4 @@\n func main() {\n-x\n+y\n",
+			"line 3: hunk announces 4 old and 4 new lines but contains 2 old and 2 new lines"},
+		{"Unexpected line", "--- a/main.go\n+++ b/main.go\n@@ -3,3 +3,3 @@\n func main() {\noops\n",
+			"line 5: unexpected line \"oops\" in hunk at line 3 (1/3 old and 1/3 new lines read)"},
+		{"Missing +++", "--- a/main.go\nnope\n", "line 1: file header"},
+		{"Unterminated block", "main.go\n<<<<<<< SEARCH\nx\n=======\ny\n", "line 4: replace block"},
+		{"No path", "<<<<<<< SEARCH\nx\n=======\ny\n>>>>>>> REPLACE", "line 1: search block without"},
+		{"Mismatch", "--- a/main.go\n+++ b/main.go\n@@ -3,1 +3,1 @@\n-nope\n+yes\n",
+			"main.go: hunk 1 (line 3 of the answer) does not match the file near line 3"},
+		{"Search not found", "main.go\n<<<<<<< SEARCH\nnope\n=======\nyes\n>>>>>>> REPLACE",
+			"main.go: block 1 (line 2 of the answer): search text not found"},
+		{"Ambiguous search", "main.go\n<<<<<<< SEARCH\nfunc\n=======\nfn\n>>>>>>> REPLACE",
+			"search text found 2 times"},
+		{"Escaping path", "--- a/../x\n+++ b/../x\n@@ -1 +1 @@\n-a\n+b\n", "inside the working tree"},
+		{"Changed and deleted", "--- a/main.go\n+++ b/main.go\n@@ -1 +1 @@\n-a\n+b\n" +
+			"--- a/main.go\n+++ /dev/null\n@@ -1 +0,0 @@\n-a\n", "both changed and created or deleted"},
+		{"Missing file", "--- a/nope.go\n+++ b/nope.go\n@@ -1 +1 @@\n-a\n+b\n", "does not exist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(tt.answer)
+			if err == nil {
+				_, err = p.Validate(newTree(t))
+			}
+
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestSymlinks(t *testing.T) {
+	root, outside := newTree(t), t.TempDir()
+	for name, target := range map[string]string{"escape": outside, "inner": "."} {
+		if err := os.Symlink(target, filepath.Join(root, name)); err != nil {
+			t.Skipf("symbolic links are not available: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		path string
+		err  bool
+	}{
+		{"Inside through a link", "inner/new.txt", false},
+		{"Outside through a link", "escape/new.txt", true},
+		{"Nested outside through a link", "escape/dir/new.txt", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse("--- /dev/null\n+++ b/" + tt.path + "\n@@ -0,0 +1 @@\n+new\n")
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+
+			changes, err := p.Validate(root)
+			if tt.err {
+				if err == nil || !strings.Contains(err.Error(), "outside of the working tree") {
+					t.Errorf("Expected the path to be rejected, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to validate: %v", err)
+			}
+			if err := Apply(root, changes); err != nil {
+				t.Fatalf("Failed to apply: %v", err)
+			}
+		})
+	}
+
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("Expected nothing to be written outside of the tree, got %v", entries)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "new.txt")); string(data) != "new\n" {
+		t.Errorf("Expected the file to be created through the inner link, got %q", data)
+	}
+}
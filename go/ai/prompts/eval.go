@@ -37,6 +37,12 @@ func (ctx *EvalContext) Evaluate(prompt string) (string, error) {
 	return ctx.execute(content, nil)
 }
 
+// Instruction evaluates the instruction with the given name and arguments.
+// It is meant for instructions that are added programmatically rather than by a prompt.
+func (ctx *EvalContext) Instruction(name string, args ...any) (string, error) {
+	return ctx.instruction(name, args...)
+}
+
 func (ctx *EvalContext) functions() template.FuncMap {
 	return template.FuncMap{
 		"git":     gitCommand,
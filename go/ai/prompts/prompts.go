@@ -12,10 +12,18 @@ import (
 var EmbeddedBytes []byte
 
 type Library struct {
-	Prompts      map[string]string `yaml:"prompts"`
-	Personas     map[string]string `yaml:"personas"`
-	Instructions map[string]string `yaml:"instructions"`
-	Section1     map[string]string `yaml:"section1"`
+	Prompts      map[string]string      `yaml:"prompts"`
+	Parameters   map[string][]Parameter `yaml:"parameters"`
+	Personas     map[string]string      `yaml:"personas"`
+	Instructions map[string]string      `yaml:"instructions"`
+	Section1     map[string]string      `yaml:"section1"`
+}
+
+// Parameter documents a positional argument of a prompt.
+type Parameter struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description"`
+	Required    bool   `yaml:"required"`
 }
 
 var Embedded = utils.OnceErr(func() (Library, error) { return FromYAML(EmbeddedBytes) })
@@ -34,3 +42,34 @@ func (lib Library) RawPrompt(name string) (string, error) {
 
 	return source, nil
 }
+
+// Positional returns the positional arguments of a prompt from named arguments, in the order of
+// the declared parameters.
+// Absent optional arguments are empty, so that the following arguments keep their position.
+func (lib Library) Positional(name string, args map[string]string) ([]string, error) {
+	var res []string
+	declared := map[string]bool{}
+	given := 0 // The number of arguments up to the last one given.
+
+	for _, param := range lib.Parameters[name] {
+		declared[param.Name] = true
+		value := args[param.Name]
+		if value == "" && param.Required {
+			return nil, fmt.Errorf("missing required argument %q for prompt %s", param.Name, name)
+		}
+
+		res = append(res, value)
+		if value != "" {
+			given = len(res)
+		}
+	}
+	res = res[:given]
+
+	for arg := range args {
+		if !declared[arg] {
+			return nil, fmt.Errorf("unknown argument %q for prompt %s", arg, name)
+		}
+	}
+
+	return res, nil
+}
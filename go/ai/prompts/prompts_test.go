@@ -99,3 +99,66 @@ func TestTemplateFunctions(t *testing.T) {
 		})
 	}
 }
+
+func TestParameters(t *testing.T) {
+	lib, err := Embedded()
+	if err != nil {
+		t.Fatalf("Failed to load embedded prompts: %v", err)
+	}
+
+	for name := range lib.Parameters {
+		if _, err := lib.RawPrompt(name); err != nil {
+			t.Errorf("Parameters declared for an unknown prompt: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name        string
+		args        map[string]string
+		expected    []string
+		expectError bool
+	}{
+		{"Required argument", map[string]string{"task": "do it"}, []string{"do it"}, false},
+		{"Missing required argument", map[string]string{}, nil, true},
+		{"Unknown argument", map[string]string{"task": "do it", "nope": "x"}, nil, true},
+	}
+	custom := Library{Parameters: map[string][]Parameter{"test_prompt": {
+		{Name: "first"}, {Name: "second", Required: true}, {Name: "third"}, {Name: "fourth"},
+	}}}
+	multiple := []struct {
+		name     string
+		args     map[string]string
+		expected []string
+	}{
+		{"Absent optional arguments keep their slot",
+			map[string]string{"second": "b", "fourth": "d"}, []string{"", "b", "", "d"}},
+		{"Trailing optional arguments are dropped", map[string]string{"second": "b"},
+			[]string{"", "b"}},
+		{"All arguments", map[string]string{"first": "a", "second": "b", "third": "c", "fourth": "d"},
+			[]string{"a", "b", "c", "d"}},
+	}
+
+	for _, tt := range multiple {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := custom.Positional("test_prompt", tt.args)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !slices.Equal(res, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, res)
+			}
+		})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := lib.Positional("dev_plan", tt.args)
+			if tt.expectError && err == nil {
+				t.Errorf("Expected error for %v, got %v", tt.args, res)
+			}
+			if !tt.expectError && !slices.Equal(res, tt.expected) {
+				t.Errorf("Expected %v for %v, got %v (%v)", tt.expected, tt.args, res, err)
+			}
+		})
+	}
+}
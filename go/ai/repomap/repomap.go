@@ -0,0 +1,162 @@
+// Package repomap outlines the Go packages of a repository, giving the structure of the code to a
+// model for a fraction of the size of the files.
+package repomap
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Symbol is a declaration of the outline.
+type Symbol struct {
+	File string
+	Line int
+	// Decl is the declaration without its body, for instance "func New() *Client".
+	Decl string
+}
+
+// Package is the outline of a Go package.
+type Package struct {
+	Name    string
+	Dir     string
+	Symbols []Symbol
+	// Errors are the files that could not be parsed.
+	Errors []string
+}
+
+// Outline returns the outline of the Go packages under root.
+// Test files, hidden directories, vendor and testdata directories are skipped.
+func Outline(root string) ([]Package, error) {
+	byDir := map[string]*Package{}
+	fset := token.NewFileSet()
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		name := entry.Name()
+		if entry.IsDir() {
+			if path != root && (strings.HasPrefix(name, ".") || name == "vendor" ||
+				name == "testdata") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+
+		dir := filepath.Dir(path)
+		pkg, exists := byDir[dir]
+		if !exists {
+			pkg = &Package{Dir: dir}
+			byDir[dir] = pkg
+		}
+
+		file, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			pkg.Errors = append(pkg.Errors, err.Error())
+			return nil
+		}
+
+		pkg.Name = file.Name.Name
+		pkg.Symbols = append(pkg.Symbols, symbols(fset, path, file)...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]Package, 0, len(byDir))
+	for _, pkg := range byDir {
+		res = append(res, *pkg)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Dir < res[j].Dir })
+
+	return res, nil
+}
+
+// Render returns the outline as text, one declaration per line prefixed by its location.
+func Render(packages []Package) string {
+	var buf strings.Builder
+	for i, pkg := range packages {
+		if i > 0 {
+			buf.WriteString("\n")
+		}
+
+		fmt.Fprintf(&buf, "package %s (%s)\n", pkg.Name, pkg.Dir)
+		for _, symbol := range pkg.Symbols {
+			fmt.Fprintf(&buf, "  %s:%d: %s\n", symbol.File, symbol.Line, symbol.Decl)
+		}
+		for _, err := range pkg.Errors {
+			fmt.Fprintf(&buf, "  %s\n", err)
+		}
+	}
+
+	return buf.String()
+}
+
+///////////////////
+// Declarations //
+
+// symbols returns the types, functions and methods declared in the file, in order.
+func symbols(fset *token.FileSet, path string, file *ast.File) []Symbol {
+	var res []Symbol
+	add := func(node ast.Node, decl string) {
+		res = append(res, Symbol{File: path, Line: fset.Position(node.Pos()).Line, Decl: decl})
+	}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			signature := *decl
+			signature.Body, signature.Doc = nil, nil
+			add(decl, format(fset, &signature))
+
+		case *ast.GenDecl:
+			if decl.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				spec := spec.(*ast.TypeSpec)
+				add(spec, "type "+typeDecl(fset, spec))
+			}
+		}
+	}
+
+	return res
+}
+
+// typeDecl returns the declaration of a type, without the fields of structs and interfaces.
+func typeDecl(fset *token.FileSet, spec *ast.TypeSpec) string {
+	res := *spec
+	res.Doc, res.Comment = nil, nil
+	switch spec.Type.(type) {
+	case *ast.StructType:
+		res.Type = ast.NewIdent("struct")
+	case *ast.InterfaceType:
+		res.Type = ast.NewIdent("interface")
+	}
+
+	return format(fset, &res)
+}
+
+// format prints the node on a single line.
+func format(fset *token.FileSet, node any) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return fmt.Sprintf("<%s>", err)
+	}
+
+	return strings.Join(strings.Fields(buf.String()), " ")
+}
@@ -0,0 +1,80 @@
+//nolint:revive
+package repomap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const source = `package shapes
+
+import "io"
+
+// Shape is a geometric shape.
+type Shape interface {
+	Area() float64
+}
+
+type (
+	point struct{ x, y float64 }
+	Name  = string
+	Pair[T any] [2]T
+)
+
+// Render writes the shape.
+func Render(w io.Writer, shapes ...Shape) (int,
+	error) {
+	return 0, nil
+}
+
+func (p *point) move(dx, dy float64) { p.x += dx }
+
+var ignored = 1
+`
+
+func TestOutline(t *testing.T) {
+	root := t.TempDir()
+	files := map[string]string{
+		"shapes/shapes.go":      source,
+		"shapes/shapes_test.go": "package shapes\n\nfunc TestNothing() {}\n",
+		"shapes/broken.go":      "package shapes\n\nfunc {\n",
+		".hidden/hidden.go":     "package hidden\n\nfunc Hidden() {}\n",
+		"README.md":             "not go",
+	}
+	for path, content := range files {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	packages, err := Outline(root)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(packages) != 1 {
+		t.Fatalf("Expected a single package, got %+v", packages)
+	}
+
+	file := filepath.Join(root, "shapes", "shapes.go")
+	expected := "package shapes (" + filepath.Join(root, "shapes") + ")\n" +
+		"  " + file + ":6: type Shape interface\n" +
+		"  " + file + ":11: type point struct\n" +
+		"  " + file + ":12: type Name = string\n" +
+		"  " + file + ":13: type Pair[T any] [2]T\n" +
+		"  " + file + ":17: func Render(w io.Writer, shapes ...Shape) (int, error)\n" +
+		"  " + file + ":22: func (p *point) move(dx, dy float64)\n"
+
+	rendered := Render(packages)
+	if !strings.HasPrefix(rendered, expected) {
+		t.Errorf("Expected outline starting with:\n%s\ngot:\n%s", expected, rendered)
+	}
+	if !strings.Contains(rendered, "broken.go:3") {
+		t.Errorf("Expected the parse error of broken.go to be reported, got:\n%s", rendered)
+	}
+}
@@ -0,0 +1,210 @@
+// This file handles structured findings, written as SARIF or as GitHub annotations.
+
+package review
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Severities of the issues, from the most to the least severe.
+const (
+	Critical  = "critical"
+	Important = "important"
+	Minor     = "minor"
+)
+
+var severities = []string{Critical, Important, Minor}
+
+// Issue is a finding anchored to a line.
+type Issue struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// issueLine matches the first line of an issue: - [severity] path:LINE: message.
+var issueLine = regexp.MustCompile(
+	`^\s*[-*]\s*\[(critical|important|minor)\]\s+(\S+?):(\d+):\s*(.*)$`)
+
+// ParseIssues extracts the issues from an answer following the format of the chunk_review and
+// structured_findings instructions.
+// Indented lines following an issue continue its message, other lines are ignored.
+func ParseIssues(answer string) []Issue {
+	var res []Issue
+	for _, line := range strings.Split(answer, "\n") {
+		if match := issueLine.FindStringSubmatch(line); match != nil {
+			number, _ := strconv.Atoi(match[3])
+			res = append(res, Issue{
+				File: strings.Trim(match[2], "`"), Line: number, Severity: match[1],
+				Message: strings.TrimSpace(match[4]),
+			})
+			continue
+		}
+
+		continued := strings.TrimSpace(line)
+		if len(res) > 0 && continued != "" && continued != "```" &&
+			(strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			last := &res[len(res)-1]
+			last.Message = strings.TrimSpace(last.Message + " " + continued)
+		}
+	}
+
+	return res
+}
+
+// SortIssues sorts the issues by severity, file and line, and removes the duplicates.
+func SortIssues(issues []Issue) []Issue {
+	slices.SortStableFunc(issues, func(a, b Issue) int {
+		return cmp.Or(
+			cmp.Compare(slices.Index(severities, a.Severity), slices.Index(severities, b.Severity)),
+			cmp.Compare(a.File, b.File),
+			cmp.Compare(a.Line, b.Line),
+		)
+	})
+
+	return slices.Compact(issues)
+}
+
+/////////////
+// Formats //
+
+// Formats are the output formats of the issues.
+var Formats = []string{"text", "sarif", "github"}
+
+// CheckFormat returns an error when format is not one of Formats.
+func CheckFormat(format string) error {
+	if !slices.Contains(Formats, format) {
+		return fmt.Errorf("unknown format %q, expected one of %s", format,
+			strings.Join(Formats, ", "))
+	}
+
+	return nil
+}
+
+// WriteIssues writes the issues in the given format.
+func WriteIssues(w io.Writer, format string, issues []Issue) error {
+	switch format {
+	case "sarif":
+		return WriteSARIF(w, issues)
+	case "github":
+		return WriteAnnotations(w, issues)
+	case "text":
+		for _, issue := range issues {
+			if _, err := fmt.Fprintf(w, "- [%s] %s:%d: %s\n",
+				issue.Severity, issue.File, issue.Line, issue.Message); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return CheckFormat(format)
+}
+
+// WriteAnnotations writes the issues as GitHub Actions workflow commands, displayed inline by
+// GitHub.
+func WriteAnnotations(w io.Writer, issues []Issue) error {
+	for _, issue := range issues {
+		properties := "file=" + escapeProperty(issue.File)
+		if issue.Line > 0 {
+			properties += fmt.Sprintf(",line=%d", issue.Line)
+		}
+		properties += ",title=" + escapeProperty("jenai "+issue.Severity)
+
+		_, err := fmt.Fprintf(w, "::%s %s::%s\n",
+			annotationLevels[issue.Severity], properties, escapeData(issue.Message))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var annotationLevels = map[string]string{Critical: "error", Important: "warning", Minor: "notice"}
+
+func escapeData(text string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(text)
+}
+
+func escapeProperty(text string) string {
+	return strings.NewReplacer(":", "%3A", ",", "%2C").Replace(escapeData(text))
+}
+
+// WriteSARIF writes the issues as a SARIF 2.1.0 log.
+func WriteSARIF(w io.Writer, issues []Issue) error {
+	type (
+		message struct {
+			Text string `json:"text"`
+		}
+		region struct {
+			StartLine int `json:"startLine"`
+		}
+		artifact struct {
+			URI string `json:"uri"`
+		}
+		physical struct {
+			ArtifactLocation artifact `json:"artifactLocation"`
+			Region           *region  `json:"region,omitempty"`
+		}
+		location struct {
+			PhysicalLocation physical `json:"physicalLocation"`
+		}
+		result struct {
+			RuleID    string     `json:"ruleId"`
+			Level     string     `json:"level"`
+			Message   message    `json:"message"`
+			Locations []location `json:"locations"`
+		}
+		rule struct {
+			ID               string  `json:"id"`
+			ShortDescription message `json:"shortDescription"`
+		}
+	)
+
+	rules := make([]rule, 0, len(severities))
+	for _, severity := range severities {
+		rules = append(rules, rule{ID: severity, ShortDescription: message{severity + " issue"}})
+	}
+
+	results := make([]result, 0, len(issues))
+	for _, issue := range issues {
+		loc := physical{ArtifactLocation: artifact{issue.File}}
+		if issue.Line > 0 {
+			loc.Region = &region{issue.Line}
+		}
+		results = append(results, result{
+			RuleID:    issue.Severity,
+			Level:     sarifLevels[issue.Severity],
+			Message:   message{issue.Message},
+			Locations: []location{{loc}},
+		})
+	}
+
+	log := map[string]any{
+		"$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+		"version": "2.1.0",
+		"runs": []any{map[string]any{
+			"tool":    map[string]any{"driver": map[string]any{"name": "jenai", "rules": rules}},
+			"results": results,
+		}},
+	}
+
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+var sarifLevels = map[string]string{Critical: "error", Important: "warning", Minor: "note"}
@@ -0,0 +1,174 @@
+// Package review reviews diffs too large for a single prompt.
+//
+// The diff is split into chunks reviewed concurrently, and a final synthesis pass merges the
+// findings of every chunk into a single report.
+package review
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/mooss/jen/go/ai/errs"
+	"github.com/mooss/jen/go/ai/jenai"
+	"github.com/mooss/jen/go/ai/prompts"
+)
+
+// Reviewer reviews diffs chunk by chunk.
+type Reviewer struct {
+	// Client sends the synthesis, which is written to its output and recorded in its session.
+	// Chunks are reviewed with copies of the client that record nothing.
+	Client *jenai.Client
+	// Budget is the maximum number of tokens of the diff of a chunk.
+	Budget int
+	// Jobs is the number of chunks reviewed concurrently.
+	Jobs int
+	// Log receives the progress of the review, it can be nil.
+	Log io.Writer
+
+	logMutex sync.Mutex
+}
+
+// Finding is the review of a chunk.
+type Finding struct {
+	Chunk   Chunk
+	Content string
+}
+
+// Diff returns the git diff of a range of revisions, such as main..feature.
+func Diff(ctx context.Context, revisions string) (string, error) {
+	if revisions == "" || strings.HasPrefix(revisions, "-") {
+		return "", errs.InputErr(fmt.Errorf("invalid range %q", revisions))
+	}
+
+	cmd := exec.CommandContext(ctx, "git", "diff", revisions, "--")
+	output, err := cmd.Output()
+	if err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) {
+			return "", errs.InputErr(fmt.Errorf("git diff %s failed: %w:\n%s",
+				revisions, err, exit.Stderr))
+		}
+		return "", err
+	}
+
+	return string(output), nil
+}
+
+// Review reviews the diff and returns the synthesis of the findings.
+func (rev *Reviewer) Review(ctx context.Context, diff string) (jenai.Reply, error) {
+	findings, err := rev.reviewChunks(ctx, diff)
+	if err != nil {
+		return jenai.Reply{}, err
+	}
+
+	rev.logf("Synthesizing the findings of %d chunks\n", len(findings))
+	message, err := rev.synthesis(findings)
+	if err != nil {
+		return jenai.Reply{}, err
+	}
+
+	return rev.Client.Send(ctx, message)
+}
+
+// Issues reviews the diff and returns the issues found in every chunk, without synthesis.
+func (rev *Reviewer) Issues(ctx context.Context, diff string) ([]Issue, error) {
+	findings, err := rev.reviewChunks(ctx, diff)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []Issue
+	for _, finding := range findings {
+		res = append(res, ParseIssues(finding.Content)...)
+	}
+
+	return SortIssues(res), nil
+}
+
+// reviewChunks splits the diff and reviews the chunks concurrently, returning their findings in
+// order.
+func (rev *Reviewer) reviewChunks(ctx context.Context, diff string) ([]Finding, error) {
+	chunks := Split(diff, rev.Budget)
+	if len(chunks) == 0 {
+		return nil, errs.InputErr(errors.New("the diff is empty"))
+	}
+
+	client, err := rev.Client.Fork("", "")
+	if err != nil {
+		return nil, err
+	}
+	client.Output = nil
+
+	var (
+		res      = make([]Finding, len(chunks))
+		failures = make([]error, len(chunks))
+		wg       sync.WaitGroup
+		jobs     = make(chan struct{}, max(rev.Jobs, 1))
+	)
+
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			jobs <- struct{}{}
+			defer func() { <-jobs }()
+
+			position := fmt.Sprintf("%d of %d", i+1, len(chunks))
+			rev.logf("Reviewing chunk %s (%s)\n", position, strings.Join(chunk.Files, ", "))
+
+			message, err := chunkMessage(client.Library, position, chunk)
+			if err == nil {
+				var reply jenai.Reply
+				reply, err = client.Send(ctx, message)
+				res[i] = Finding{Chunk: chunk, Content: reply.Content}
+			}
+			if err != nil {
+				failures[i] = fmt.Errorf("chunk %s: %w", position, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	return res, errors.Join(failures...)
+}
+
+// chunkMessage returns the message asking for the review of a chunk.
+func chunkMessage(lib prompts.Library, position string, chunk Chunk) (string, error) {
+	instruction, err := prompts.NewEvalContext(lib, nil).Instruction("chunk_review", position)
+	if err != nil {
+		return "", errs.PromptErr(err)
+	}
+
+	return fmt.Sprintf("%s\n\n# Diff\n\n```diff\n%s```", instruction, NumberDiff(chunk.Diff)), nil
+}
+
+// synthesis returns the message asking for the synthesis of the findings.
+func (rev *Reviewer) synthesis(findings []Finding) (string, error) {
+	instruction, err := prompts.NewEvalContext(rev.Client.Library, nil).
+		Instruction("review_synthesis")
+	if err != nil {
+		return "", errs.PromptErr(err)
+	}
+
+	var buf strings.Builder
+	buf.WriteString(instruction)
+	for i, finding := range findings {
+		fmt.Fprintf(&buf, "\n\n# Findings of part %d (%s)\n\n%s", i+1,
+			strings.Join(finding.Chunk.Files, ", "), strings.TrimSpace(finding.Content))
+	}
+
+	return buf.String(), nil
+}
+
+func (rev *Reviewer) logf(format string, args ...any) {
+	if rev.Log != nil {
+		rev.logMutex.Lock()
+		defer rev.logMutex.Unlock()
+		fmt.Fprintf(rev.Log, format, args...)
+	}
+}
@@ -0,0 +1,218 @@
+//nolint:revive
+package review
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mooss/jen/go/ai/config"
+	"github.com/mooss/jen/go/ai/jenai"
+	"github.com/mooss/jen/go/ai/models"
+	"github.com/mooss/jen/go/ai/prompts"
+	"github.com/mooss/jen/go/utils"
+)
+
+// fileDiffText returns the diff of a file with the given number of hunks.
+func fileDiffText(path string, hunks int) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "diff --git a/%s b/%s\nindex 1111111..2222222 100644\n--- a/%s\n+++ b/%s\n",
+		path, path, path, path)
+	for i := range hunks {
+		fmt.Fprintf(&buf, "@@ -%d,2 +%d,2 @@\n context\n-old line %d\n+new line %d\n",
+			i*10+1, i*10+1, i, i)
+	}
+
+	return buf.String()
+}
+
+func TestSplit(t *testing.T) {
+	small, other, large := fileDiffText("a.go", 1), fileDiffText("b.go", 1), fileDiffText("c.go", 6)
+	diff := small + other + large
+	budget := utils.Tokens(small + other)
+
+	chunks := Split(diff, budget)
+	var files [][]string
+	for _, chunk := range chunks {
+		files = append(files, chunk.Files)
+		if !strings.HasPrefix(chunk.Diff, "diff --git ") {
+			t.Errorf("Expected chunk to start with a file header, got %q", chunk.Diff)
+		}
+	}
+
+	if len(chunks) < 3 || fmt.Sprint(files[0]) != "[a.go b.go]" {
+		t.Fatalf("Expected a.go and b.go packed together and c.go split, got %v", files)
+	}
+
+	var rebuilt strings.Builder
+	rebuilt.WriteString(chunks[0].Diff)
+	for _, chunk := range chunks[1:] {
+		if fmt.Sprint(chunk.Files) != "[c.go]" {
+			t.Errorf("Expected the remaining chunks to be parts of c.go, got %v", chunk.Files)
+		}
+		if utils.Tokens(chunk.Diff) > budget {
+			t.Errorf("Expected chunk under %d tokens, got %d", budget, utils.Tokens(chunk.Diff))
+		}
+		_, hunks, _ := strings.Cut(chunk.Diff, "@@ ")
+		rebuilt.WriteString("@@ " + hunks)
+	}
+
+	if !strings.Contains(rebuilt.String(), "+new line 5\n") ||
+		strings.Count(rebuilt.String(), "@@ -") != 8 {
+		t.Errorf("Expected every hunk to be kept exactly once, got %q", rebuilt.String())
+	}
+}
+
+func TestDiffPath(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected string
+	}{
+		{"diff --git a/x.go b/x.go\n--- a/x.go\n+++ b/x.go\n", "x.go"},
+		{"diff --git a/gone.go b/gone.go\n--- a/gone.go\n+++ /dev/null\n", "gone.go"},
+		{"diff --git a/img.png b/img.png\nBinary files differ\n", "img.png"},
+	}
+
+	for _, tt := range tests {
+		if got := diffPath(tt.header); got != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, got)
+		}
+	}
+}
+
+// echo is a fake model answering with the files of the chunk it reviews.
+type echo struct {
+	mutex    sync.Mutex
+	messages []string
+}
+
+func (e *echo) Send(_ context.Context, req jenai.Request, out io.Writer) (string, error) {
+	e.mutex.Lock()
+	e.messages = append(e.messages, req.Message)
+	e.mutex.Unlock()
+
+	answer := "None"
+	if strings.Contains(req.Message, "+++ b/b.go") {
+		answer = "- [critical] b.go:2: broken"
+	}
+	if strings.Contains(req.Message, "# Findings of part") {
+		answer = "## Critical Issues\nb.go:2: broken"
+	}
+
+	_, err := io.WriteString(out, answer)
+	return answer, err
+}
+
+func TestReview(t *testing.T) {
+	lib, err := prompts.Embedded()
+	if err != nil {
+		t.Fatalf("Failed to load embedded prompts: %v", err)
+	}
+
+	backend := &echo{}
+	client := jenai.New(lib, models.Spec{}, config.SessionMetadata{Dir: t.TempDir(), Name: "test"})
+	client.Backend = backend
+	var out bytes.Buffer
+	client.Output = &out
+
+	diff := fileDiffText("a.go", 1) + fileDiffText("b.go", 1) + fileDiffText("c.go", 1)
+	reviewer := &Reviewer{Client: client, Budget: utils.Tokens(fileDiffText("a.go", 1)), Jobs: 2}
+	reply, err := reviewer.Review(context.Background(), diff)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(backend.messages) != 4 {
+		t.Fatalf("Expected 3 chunk reviews and a synthesis, got %d messages", len(backend.messages))
+	}
+
+	synthesis := backend.messages[3]
+	for _, expected := range []string{
+		"# Findings of part 1 (a.go)\n\nNone", "# Findings of part 2 (b.go)\n\n- [critical] b.go:2",
+	} {
+		if !strings.Contains(synthesis, expected) {
+			t.Errorf("Expected the synthesis prompt to contain %q, got %q", expected, synthesis)
+		}
+	}
+
+	if out.String() != reply.Content || !strings.Contains(out.String(), "Critical") {
+		t.Errorf("Expected only the synthesis in the output, got %q", out.String())
+	}
+}
+
+func TestNumberDiff(t *testing.T) {
+	diff := "diff --git a/x.go b/x.go\n--- a/x.go\n+++ b/x.go\n@@ -10,3 +12,3 @@ func f() {\n" +
+		" keep\n-old\n+new\n same\n"
+	expected := "diff --git a/x.go b/x.go\n--- a/x.go\n+++ b/x.go\n@@ -10,3 +12,3 @@ func f() {\n" +
+		"   12:  keep\n     : -old\n   13: +new\n   14:  same\n"
+
+	if got := NumberDiff(diff); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestIssues(t *testing.T) {
+	answer := "Here are the findings:\n" +
+		"- [minor] b.go:3: unclear name\n" +
+		"- [critical] `a.go`:10: nil dereference,\n  check the error first\n" +
+		"- [minor] b.go:3: unclear name\n" +
+		"* [important] a.go:2: leaked file: close it\n" +
+		"Some prose.\n"
+
+	issues := SortIssues(ParseIssues(answer))
+	expected := []Issue{
+		{"a.go", 10, Critical, "nil dereference, check the error first"},
+		{"a.go", 2, Important, "leaked file: close it"},
+		{"b.go", 3, Minor, "unclear name"},
+	}
+	if fmt.Sprint(issues) != fmt.Sprint(expected) {
+		t.Fatalf("Expected %v, got %v", expected, issues)
+	}
+
+	var annotations bytes.Buffer
+	if err := WriteIssues(&annotations, "github", issues[1:2]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := annotations.String(); got !=
+		"::warning file=a.go,line=2,title=jenai important::leaked file: close it\n" {
+		t.Errorf("Unexpected annotation %q", got)
+	}
+
+	var sarif bytes.Buffer
+	if err := WriteIssues(&sarif, "sarif", issues); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var log struct {
+		Version string
+		Runs    []struct {
+			Results []struct {
+				RuleID    string
+				Level     string
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct{ URI string }
+						Region           struct{ StartLine int }
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(sarif.Bytes(), &log); err != nil {
+		t.Fatalf("Invalid SARIF: %v", err)
+	}
+	result := log.Runs[0].Results[0]
+	location := result.Locations[0].PhysicalLocation
+	if log.Version != "2.1.0" || result.Level != "error" || result.RuleID != Critical ||
+		location.ArtifactLocation.URI != "a.go" || location.Region.StartLine != 10 {
+		t.Errorf("Unexpected SARIF log %s", sarif.String())
+	}
+
+	if err := WriteIssues(io.Discard, "xml", issues); err == nil {
+		t.Error("Expected an error for an unknown format, got nil")
+	}
+}
@@ -0,0 +1,159 @@
+package review
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mooss/jen/go/utils"
+)
+
+// Chunk is a part of a diff reviewed on its own.
+type Chunk struct {
+	// Files are the paths of the files changed in the chunk.
+	Files []string
+	// Diff is the part of the diff, with the headers of its files.
+	Diff string
+}
+
+// Split splits a git diff into chunks of at most budget tokens.
+// Files are packed together as long as they fit in the budget. A file exceeding the budget is
+// split into groups of hunks, repeating its header. A single hunk exceeding the budget is kept
+// whole.
+func Split(diff string, budget int) []Chunk {
+	var (
+		res     []Chunk
+		current Chunk
+	)
+
+	flush := func() {
+		if current.Diff != "" {
+			res = append(res, current)
+		}
+		current = Chunk{}
+	}
+
+	for _, file := range splitFiles(diff) {
+		if utils.Tokens(current.Diff+file.diff) <= budget {
+			current.Files = append(current.Files, file.path)
+			current.Diff += file.diff
+			continue
+		}
+
+		flush()
+		if utils.Tokens(file.diff) <= budget {
+			current = Chunk{Files: []string{file.path}, Diff: file.diff}
+			continue
+		}
+
+		for _, part := range file.split(budget) {
+			res = append(res, Chunk{Files: []string{file.path}, Diff: part})
+		}
+	}
+	flush()
+
+	return res
+}
+
+// fileDiff is the diff of a single file.
+type fileDiff struct {
+	path   string
+	header string
+	hunks  []string
+	diff   string
+}
+
+// splitFiles splits a git diff into the diffs of its files.
+func splitFiles(diff string) []fileDiff {
+	var res []fileDiff
+	for _, part := range utils.SplitBeforeLines(diff, "diff --git ") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+
+		sections := utils.SplitBeforeLines(part, "@@ ")
+		file := fileDiff{header: sections[0], hunks: sections[1:], diff: part}
+		file.path = diffPath(file.header)
+		res = append(res, file)
+	}
+
+	return res
+}
+
+// split splits the hunks of the file into groups of at most budget tokens, each preceded by the
+// header of the file.
+func (file fileDiff) split(budget int) []string {
+	var (
+		res     []string
+		current = file.header
+	)
+
+	for _, hunk := range file.hunks {
+		if current != file.header && utils.Tokens(current+hunk) > budget {
+			res = append(res, current)
+			current = file.header
+		}
+		current += hunk
+	}
+
+	return append(res, current)
+}
+
+// diffPath returns the path of the file from the header of its diff.
+func diffPath(header string) string {
+	deleted := ""
+	for _, line := range strings.Split(header, "\n") {
+		if path, found := strings.CutPrefix(line, "+++ b/"); found {
+			return path
+		}
+		if path, found := strings.CutPrefix(line, "--- a/"); found {
+			deleted = path
+		}
+	}
+	if deleted != "" {
+		return deleted
+	}
+
+	first, _, _ := strings.Cut(header, "\n")
+	if _, path, found := strings.Cut(first, " b/"); found {
+		return path // Binary file or mode change, without --- and +++ lines.
+	}
+
+	return first
+}
+
+// NumberDiff prefixes the lines of the hunks of a diff with their number in the new version of
+// the file, so that findings can be anchored to lines. Removed lines have no number.
+func NumberDiff(diff string) string {
+	var buf strings.Builder
+	line := 0
+	inHunk := false
+
+	for _, text := range strings.SplitAfter(diff, "\n") {
+		if match := hunkStart.FindStringSubmatch(text); match != nil {
+			line, _ = strconv.Atoi(match[1])
+			inHunk = true
+			buf.WriteString(text)
+			continue
+		}
+
+		switch {
+		case text == "":
+		case strings.HasPrefix(text, "diff --git "):
+			inHunk = false
+			buf.WriteString(text)
+		case !inHunk || strings.HasPrefix(text, `\`):
+			buf.WriteString(text)
+		case strings.HasPrefix(text, "-"):
+			buf.WriteString("     : " + text)
+		default:
+			fmt.Fprintf(&buf, "%5d: %s", line, text)
+			line++
+		}
+	}
+
+	return buf.String()
+}
+
+var hunkStart = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,\d+)? @@`)
@@ -0,0 +1,266 @@
+// Package secrets detects the credentials that should not be sent to a model provider, such as
+// private keys and access tokens, and redacts them.
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mooss/jen/go/utils"
+)
+
+// Rule detects a kind of secret.
+type Rule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	// Value is the index of the group holding the secret, 0 for the whole match.
+	Value int
+	// MinEntropy is the minimum Shannon entropy per character of the secret, 0 to accept any.
+	// Secrets checked for entropy must also mix letters and digits, to skip identifiers.
+	MinEntropy float64
+}
+
+// Builtin are the rules of the most common secrets.
+var Builtin = []Rule{
+	{Name: "private-key", Pattern: regexp.MustCompile(
+		`-----BEGIN [A-Z0-9 ]*PRIVATE KEY( BLOCK)?-----[\s\S]*?-----END [A-Z0-9 ]*PRIVATE KEY` +
+			`( BLOCK)?-----`)},
+	{Name: "aws-access-key-id", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Name: "aws-secret-access-key", Pattern: regexp.MustCompile(
+		`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+=]{40})\b`), Value: 1},
+	{Name: "github-token", Pattern: regexp.MustCompile(
+		`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_\w{40,})\b`)},
+	{Name: "slack-token", Pattern: regexp.MustCompile(`\bxox[abpors]-[A-Za-z0-9-]{10,}\b`)},
+	{Name: "api-key", Pattern: regexp.MustCompile(
+		`\b(?:sk-[A-Za-z0-9_-]{20,}|AIza[0-9A-Za-z_-]{35})\b`)},
+	{Name: "jwt", Pattern: regexp.MustCompile(
+		`\beyJ[A-Za-z0-9_-]{8,}\.eyJ[A-Za-z0-9_-]{8,}\.[A-Za-z0-9_-]{8,}\b`)},
+	// Random-looking values assigned to secret-looking names, as found in .env files.
+	{Name: "high-entropy-secret", Pattern: regexp.MustCompile(
+		`(?i)(?:secret|token|passw(?:or)?d|api_?key|private_?key|credentials?)\w*["']?\s*[:=]\s*` +
+			`["']?([A-Za-z0-9+/=_.~-]{16,})`), Value: 1, MinEntropy: 3.5},
+}
+
+// Finding is a secret detected in a text.
+type Finding struct {
+	Rule string
+	// Line is the line of the start of the secret, starting from 1.
+	Line int
+	// start and end are the byte offsets of the secret.
+	start, end int
+	secret     string
+}
+
+// Preview returns the secret with most of its characters masked.
+func (f Finding) Preview() string {
+	runes := []rune(f.secret)
+	if len(runes) <= 8 {
+		return strings.Repeat("*", len(runes))
+	}
+
+	return fmt.Sprintf("%s… (%d characters)", string(runes[:4]), len(runes))
+}
+
+// Scanner detects secrets with a set of rules.
+type Scanner struct {
+	Rules []Rule
+	// Allow are the patterns of the values that are not secrets, such as documented examples.
+	Allow []*regexp.Regexp
+}
+
+// Config is the YAML configuration of the user rules.
+type Config struct {
+	Rules []struct {
+		Name    string `yaml:"name"`
+		Pattern string `yaml:"pattern"`
+	} `yaml:"rules"`
+	Allow []string `yaml:"allow"`
+}
+
+// Load returns a scanner with the builtin rules and the rules of the YAML configuration file, which
+// is optional.
+func Load(path string) (*Scanner, error) {
+	res := &Scanner{Rules: Builtin}
+	conf, err := utils.FromYAMLFile[Config](path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return res, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load secret rules from %s: %w", path, err)
+	}
+
+	for _, rule := range conf.Rules {
+		pattern, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secret rule %s in %s: %w", rule.Name, path, err)
+		}
+		res.Rules = append(res.Rules, Rule{Name: rule.Name, Pattern: pattern})
+	}
+
+	for _, allow := range conf.Allow {
+		pattern, err := regexp.Compile(allow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed secret in %s: %w", path, err)
+		}
+		res.Allow = append(res.Allow, pattern)
+	}
+
+	return res, nil
+}
+
+// Scan returns the secrets of the text, in order of appearance.
+// Overlapping secrets are reported once, by the first rule detecting them.
+func (s *Scanner) Scan(text string) []Finding {
+	var res []Finding
+	for _, rule := range s.Rules {
+		for _, match := range rule.Pattern.FindAllStringSubmatchIndex(text, -1) {
+			start, end := match[2*rule.Value], match[2*rule.Value+1]
+			if start < 0 {
+				continue
+			}
+
+			secret := text[start:end]
+			if !random(secret, rule.MinEntropy) || s.allowed(secret) || overlaps(res, start, end) {
+				continue
+			}
+
+			res = append(res, Finding{
+				Rule:   rule.Name,
+				Line:   strings.Count(text[:start], "\n") + 1,
+				start:  start,
+				end:    end,
+				secret: secret,
+			})
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool { return res[i].start < res[j].start })
+	return res
+}
+
+// Redact returns the text with its secrets replaced by [REDACTED rule], along with the secrets.
+func (s *Scanner) Redact(text string) (string, []Finding) {
+	findings := s.Scan(text)
+
+	var buf strings.Builder
+	last := 0
+	for _, finding := range findings {
+		buf.WriteString(text[last:finding.start])
+		buf.WriteString("[REDACTED " + finding.Rule + "]")
+		last = finding.end
+	}
+	buf.WriteString(text[last:])
+
+	return buf.String(), findings
+}
+
+// Policy decides what happens to the texts containing secrets before they leave the machine: they
+// are blocked unless the secrets are allowed or redacted.
+type Policy struct {
+	// Scanner detects the secrets, the builtin rules are used when nil.
+	Scanner *Scanner
+	// Allow sends the secrets as is.
+	Allow bool
+	// Redact replaces the secrets instead of blocking the text.
+	Redact bool
+	// Log receives a notice when secrets are redacted, it can be nil.
+	Log io.Writer
+	// Hint tells the user how to send a blocked text, for instance with a flag.
+	Hint string
+}
+
+// Apply returns the text to send, redacted if the policy says so.
+// The error describes the secrets of a blocked text.
+func (p Policy) Apply(text string) (string, error) {
+	if p.Allow {
+		return text, nil
+	}
+
+	scanner := p.Scanner
+	if scanner == nil {
+		scanner = &Scanner{Rules: Builtin}
+	}
+
+	redacted, findings := scanner.Redact(text)
+	if len(findings) == 0 {
+		return text, nil
+	}
+	if !p.Redact {
+		hint := p.Hint
+		if hint == "" {
+			hint = "remove them"
+		}
+		return "", fmt.Errorf("the text sent to the model contains secrets, %s:\n%s",
+			hint, strings.TrimSuffix(Report(findings), "\n"))
+	}
+
+	if p.Log != nil {
+		fmt.Fprintf(p.Log, "Redacted %d secrets\n", len(findings))
+	}
+	return redacted, nil
+}
+
+// Report describes the findings, one per line.
+func Report(findings []Finding) string {
+	var buf strings.Builder
+	for _, finding := range findings {
+		fmt.Fprintf(&buf, "line %d: %s %s\n", finding.Line, finding.Rule, finding.Preview())
+	}
+
+	return buf.String()
+}
+
+func (s *Scanner) allowed(secret string) bool {
+	for _, pattern := range s.Allow {
+		if pattern.MatchString(secret) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func overlaps(findings []Finding, start, end int) bool {
+	for _, finding := range findings {
+		if start < finding.end && finding.start < end {
+			return true
+		}
+	}
+
+	return false
+}
+
+// random returns true when the text looks random enough: no check for a null minimum entropy.
+func random(text string, minEntropy float64) bool {
+	if minEntropy == 0 {
+		return true
+	}
+
+	return strings.ContainsAny(text, "0123456789") &&
+		strings.IndexFunc(text, unicode.IsLetter) >= 0 && entropy(text) >= minEntropy
+}
+
+// entropy returns the Shannon entropy per character of the text, in bits.
+func entropy(text string) float64 {
+	counts := map[rune]int{}
+	total := 0
+	for _, r := range text {
+		counts[r]++
+		total++
+	}
+
+	res := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		res -= p * math.Log2(p)
+	}
+
+	return res
+}
@@ -0,0 +1,205 @@
+// Package server exposes the prompt library over HTTP.
+//
+// The endpoints are:
+//   - GET /prompts lists the prompts.
+//   - POST /prompts/{name}/render returns the prompt built from the request, without sending it.
+//   - POST /prompts/{name}/run sends the prompt to the model and streams the answer.
+//
+// Context files and directories are read from the filesystem of the server, it is therefore meant
+// to listen on a local or otherwise trusted address.
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/mooss/jen/go/ai/config"
+	"github.com/mooss/jen/go/ai/errs"
+	"github.com/mooss/jen/go/ai/jenai"
+	"github.com/mooss/jen/go/ai/models"
+	"github.com/mooss/jen/go/ai/prompts"
+)
+
+// Request is the body of render and run requests.
+type Request struct {
+	// Args are the positional arguments of the prompt.
+	Args []string `json:"args"`
+	// Input is additional text, equivalent to the standard input of the CLI.
+	Input string `json:"input"`
+	// Files and Dirs are included as context.
+	Files []string `json:"files"`
+	Dirs  []string `json:"dirs"`
+	// ContextAbove puts the context above the instructions.
+	ContextAbove bool `json:"context_above"`
+	// LineNumbers prefixes the lines of the context files with their number.
+	LineNumbers bool `json:"line_numbers"`
+	// Model overrides the default model of the server (run only).
+	Model string `json:"model"`
+	// Session records the exchange in the given session (run only).
+	// The exchange is not recorded when it is empty.
+	Session string `json:"session"`
+}
+
+// Server serves the prompt library.
+type Server struct {
+	// Client is forked to answer each request.
+	Client *jenai.Client
+	mux    *http.ServeMux
+}
+
+// New returns a server for the given library, using model by default.
+func New(lib prompts.Library, model models.Spec) *Server {
+	client := jenai.New(lib, model, config.SessionMetadata{})
+	srv := &Server{Client: client, mux: http.NewServeMux()}
+	srv.mux.HandleFunc("GET /prompts", srv.list)
+	srv.mux.HandleFunc("POST /prompts/{name}/render", srv.render)
+	srv.mux.HandleFunc("POST /prompts/{name}/run", srv.run)
+	return srv
+}
+
+func (srv *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) { srv.mux.ServeHTTP(w, r) }
+
+//////////////
+// Handlers //
+
+func (srv *Server) list(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, map[string]any{"prompts": slices.Sorted(maps.Keys(srv.Client.Library.Prompts))})
+}
+
+func (srv *Server) render(w http.ResponseWriter, r *http.Request) {
+	prompt, _, ok := srv.build(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = io.WriteString(w, prompt.String())
+}
+
+func (srv *Server) run(w http.ResponseWriter, r *http.Request) {
+	prompt, req, ok := srv.build(w, r)
+	if !ok {
+		return
+	}
+
+	client, err := srv.Client.Fork(req.Model, req.Session)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// The status is only sent with the first words of the answer, so that the errors happening
+	// before, such as a blocked secret or a failure to start the backend, get their own status.
+	// Errors happening after the answer started streaming can only be reported in a trailer.
+	stream := &streamWriter{w: w, rc: http.NewResponseController(w)}
+	client.Output = stream
+
+	_, err = client.Ask(r.Context(), prompt)
+	switch {
+	case err != nil && stream.started:
+		w.Header().Set("X-Jenai-Error", err.Error())
+	case err != nil:
+		writeError(w, err)
+	case !stream.started: // Empty answer.
+		stream.start()
+	}
+}
+
+///////////////////////
+// Utility functions //
+
+// build decodes the request and builds the prompt, writing the error response when it fails.
+func (srv *Server) build(w http.ResponseWriter, r *http.Request) (jenai.Prompt, Request, bool) {
+	name := r.PathValue("name")
+	if _, err := srv.Client.Library.RawPrompt(name); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return jenai.Prompt{}, Request{}, false
+	}
+
+	var req Request
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, errs.InputErr(fmt.Errorf("invalid request body: %w", err)))
+			return jenai.Prompt{}, Request{}, false
+		}
+	}
+
+	opts := jenai.Options{
+		Name:  name,
+		Args:  req.Args,
+		Stdin: req.Input,
+		Context: config.Context{
+			Files:       req.Files,
+			Dirs:        req.Dirs,
+			Above:       req.ContextAbove,
+			LineNumbers: req.LineNumbers,
+		},
+	}
+
+	prompt, err := opts.Build(srv.Client.Library)
+	if err != nil {
+		writeError(w, err)
+		return jenai.Prompt{}, Request{}, false
+	}
+
+	return prompt, req, true
+}
+
+// statuses maps error kinds to HTTP status codes.
+var statuses = map[errs.Kind]int{
+	errs.Internal: http.StatusInternalServerError,
+	errs.Input:    http.StatusBadRequest,
+	errs.Config:   http.StatusInternalServerError,
+	errs.Prompt:   http.StatusUnprocessableEntity,
+	errs.Context:  http.StatusUnprocessableEntity,
+	errs.Backend:  http.StatusBadGateway,
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	http.Error(w, err.Error(), statuses[errs.KindOf(err)])
+}
+
+func writeJSON(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// streamWriter sends the successful status on the first write and flushes every write, so that the
+// answer is streamed to the client.
+type streamWriter struct {
+	w       http.ResponseWriter
+	rc      *http.ResponseController
+	started bool
+}
+
+func (sw *streamWriter) start() {
+	sw.started = true
+	sw.w.Header().Set("Trailer", "X-Jenai-Error")
+	sw.w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	sw.w.WriteHeader(http.StatusOK)
+}
+
+func (sw *streamWriter) Write(data []byte) (int, error) {
+	if !sw.started {
+		sw.start()
+	}
+
+	n, err := sw.w.Write(data)
+	if err != nil {
+		return n, err
+	}
+
+	return n, sw.rc.Flush()
+}
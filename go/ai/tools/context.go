@@ -0,0 +1,247 @@
+// This file defines the tools gathering context, in the same way as the --file and --dir flags.
+
+package tools
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mooss/jen/go/ai/config"
+)
+
+// Toolbox creates tools confined to a root directory.
+type Toolbox struct {
+	// Root is the directory the paths are relative to, and that they cannot escape.
+	Root string
+	// Allowed are the commands that the run tool can execute.
+	Allowed []string
+}
+
+// Context returns the tools gathering context: read_file, read_dir and git_diff.
+func (tb Toolbox) Context() []Tool {
+	return []Tool{tb.ReadFile(), tb.ReadDir(), tb.GitDiff()}
+}
+
+// ReadFile returns a tool reading files.
+func (tb Toolbox) ReadFile() Tool {
+	return Tool{
+		Name:        "read_file",
+		Description: "Read the content of files.",
+		Params: []Param{
+			{"paths", "Paths of the files, relative to the root.", Strings, true},
+			{"line_numbers", "Prefix each line with its number.", Boolean, false},
+		},
+		Run: func(_ context.Context, args Args) (string, error) {
+			paths, err := tb.pathsArg(args, "paths")
+			if err != nil {
+				return "", err
+			}
+
+			return tb.build(config.Context{Files: paths}, args)
+		},
+	}
+}
+
+// ReadDir returns a tool reading all the files in directories.
+func (tb Toolbox) ReadDir() Tool {
+	return Tool{
+		Name:        "read_dir",
+		Description: "Read the content of all files in directories, recursively.",
+		Params: []Param{
+			{"paths", "Paths of the directories, relative to the root.", Strings, true},
+			{"line_numbers", "Prefix each line with its number.", Boolean, false},
+		},
+		Run: func(_ context.Context, args Args) (string, error) {
+			paths, err := tb.pathsArg(args, "paths")
+			if err != nil {
+				return "", err
+			}
+
+			var files []string
+			for _, path := range paths {
+				walked, err := tb.walkFiles(path)
+				if err != nil {
+					return "", err
+				}
+				files = append(files, walked...)
+			}
+
+			return tb.build(config.Context{Files: files}, args)
+		},
+	}
+}
+
+// GitDiff returns a tool showing git diffs.
+func (tb Toolbox) GitDiff() Tool {
+	return Tool{
+		Name:        "git_diff",
+		Description: "Show the git diff of the working tree, of the staged changes or between revisions.",
+		Params: []Param{
+			{"staged", "Show the staged changes instead of the working tree.", Boolean, false},
+			{"revisions", "Zero, one or two revisions to compare.", Strings, false},
+			{"paths", "Restrict the diff to these paths.", Strings, false},
+		},
+		Run: func(ctx context.Context, args Args) (string, error) {
+			staged, err := args.Bool("staged")
+			if err != nil {
+				return "", err
+			}
+
+			revisions, err := revisionsArg(args, "revisions")
+			if err != nil {
+				return "", err
+			}
+			if len(revisions) > 2 {
+				return "", fmt.Errorf("at most two revisions can be compared, got %d", len(revisions))
+			}
+
+			paths, err := tb.pathsArg(args, "paths")
+			if err != nil {
+				return "", err
+			}
+
+			gitArgs := []string{"diff"}
+			if staged {
+				gitArgs = append(gitArgs, "--staged")
+			}
+			gitArgs = append(append(append(gitArgs, revisions...), "--"), paths...)
+
+			return tb.git(ctx, gitArgs...)
+		},
+	}
+}
+
+///////////////////////
+// Utility functions //
+
+// resolve returns the path joined to the root, failing if it escapes the root.
+func (tb Toolbox) resolve(path string) (string, error) {
+	root, err := filepath.Abs(tb.Root)
+	if err != nil {
+		return "", err
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path = filepath.Clean(path)
+
+	// Resolve symlinks when possible, so that they cannot be used to escape the root.
+	resolvedRoot, resolved := root, path
+	if evaluated, err := filepath.EvalSymlinks(root); err == nil {
+		resolvedRoot = evaluated
+	}
+	if evaluated, err := filepath.EvalSymlinks(path); err == nil {
+		resolved = evaluated
+	}
+
+	rel, err := filepath.Rel(resolvedRoot, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside of %s", path, root)
+	}
+
+	return path, nil
+}
+
+// walkFiles returns the files under dir that can be read, see readable.
+func (tb Toolbox) walkFiles(dir string) ([]string, error) {
+	var res []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if tb.readable(path, entry) {
+			res = append(res, path)
+		}
+		return nil
+	})
+
+	return res, err
+}
+
+// readable returns true when a walked entry is a regular file, or a symbolic link to a regular
+// file inside the root.
+// Links leading outside of the root are skipped, as well as devices and named pipes.
+func (tb Toolbox) readable(path string, entry fs.DirEntry) bool {
+	if entry.Type().IsRegular() {
+		return true
+	}
+	if entry.Type()&fs.ModeSymlink == 0 {
+		return false
+	}
+
+	if _, err := tb.resolve(path); err != nil {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// pathsArg returns the resolved paths of a string array argument.
+func (tb Toolbox) pathsArg(args Args, name string) ([]string, error) {
+	paths, err := args.Strings(name)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(paths))
+	for _, path := range paths {
+		resolved, err := tb.resolve(path)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, resolved)
+	}
+
+	return res, nil
+}
+
+// revisionsArg returns a string array argument, rejecting values that git would interpret as
+// options.
+func revisionsArg(args Args, name string) ([]string, error) {
+	revisions, err := args.Strings(name)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, revision := range revisions {
+		if strings.HasPrefix(revision, "-") {
+			return nil, fmt.Errorf("invalid revision %q", revision)
+		}
+	}
+
+	return revisions, nil
+}
+
+// build returns the content of the context, with line numbers if requested by the arguments.
+func (Toolbox) build(ctx config.Context, args Args) (string, error) {
+	var err error
+	if ctx.LineNumbers, err = args.Bool("line_numbers"); err != nil {
+		return "", err
+	}
+
+	if ctx.Empty() {
+		return "", errors.New("no path given")
+	}
+
+	content, _, err := ctx.Build()
+	return content, err
+}
+
+// git runs a git command in the root directory.
+func (tb Toolbox) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = tb.Root
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %v failed: %w:\n%s", args, err, output)
+	}
+
+	return string(output), nil
+}
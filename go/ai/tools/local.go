@@ -0,0 +1,290 @@
+// This file defines the tools exploring the local repository, meant for agentic mode.
+
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// runTimeout bounds the duration of the commands executed by the run tool.
+const runTimeout = time.Minute
+
+// Local returns all the tools available in agentic mode: the context tools, list_dir, grep,
+// git_log, git_show and run (when commands are allowed).
+func (tb Toolbox) Local() []Tool {
+	res := append(tb.Context(), tb.ListDir(), tb.Grep(), tb.GitLog(), tb.GitShow())
+	if len(tb.Allowed) > 0 {
+		res = append(res, tb.Run())
+	}
+
+	return res
+}
+
+// ListDir returns a tool listing the entries of a directory.
+func (tb Toolbox) ListDir() Tool {
+	return Tool{
+		Name:        "list_dir",
+		Description: "List the entries of a directory, directories end with a slash.",
+		Params:      []Param{{"path", "Path of the directory, the root by default.", String, false}},
+		Run: func(_ context.Context, args Args) (string, error) {
+			path, err := tb.pathArg(args, "path")
+			if err != nil {
+				return "", err
+			}
+
+			entries, err := os.ReadDir(path)
+			if err != nil {
+				return "", err
+			}
+
+			var buf strings.Builder
+			for _, entry := range entries {
+				buf.WriteString(entry.Name())
+				if entry.IsDir() {
+					buf.WriteString("/")
+				}
+				buf.WriteString("\n")
+			}
+
+			return buf.String(), nil
+		},
+	}
+}
+
+// Grep returns a tool searching a regular expression in files.
+func (tb Toolbox) Grep() Tool {
+	return Tool{
+		Name:        "grep",
+		Description: "Search a regular expression (Go syntax) in the files of a directory, recursively.",
+		Params: []Param{
+			{"pattern", "Regular expression to search.", String, true},
+			{"path", "File or directory to search in, the root by default.", String, false},
+			{"max_results", "Maximum number of matching lines, 100 by default.", Integer, false},
+		},
+		Run: func(_ context.Context, args Args) (string, error) {
+			pattern, err := args.String("pattern")
+			if err != nil {
+				return "", err
+			}
+
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return "", err
+			}
+
+			path, err := tb.pathArg(args, "path")
+			if err != nil {
+				return "", err
+			}
+
+			limit, err := args.Positive("max_results", 100)
+			if err != nil {
+				return "", err
+			}
+
+			return tb.grep(re, path, limit)
+		},
+	}
+}
+
+// GitLog returns a tool showing the commit history.
+func (tb Toolbox) GitLog() Tool {
+	return Tool{
+		Name:        "git_log",
+		Description: "Show the commit history (hash, date, author and subject).",
+		Params: []Param{
+			{"revision", "Revision or range to show, HEAD by default.", String, false},
+			{"paths", "Restrict the history to these paths.", Strings, false},
+			{"max_count", "Maximum number of commits, 20 by default.", Integer, false},
+		},
+		Run: func(ctx context.Context, args Args) (string, error) {
+			revisions, err := revisionArg(args, "revision")
+			if err != nil {
+				return "", err
+			}
+
+			paths, err := tb.pathsArg(args, "paths")
+			if err != nil {
+				return "", err
+			}
+
+			count, err := args.Positive("max_count", 20)
+			if err != nil {
+				return "", err
+			}
+
+			gitArgs := []string{"log", "--format=%h %as %an: %s", fmt.Sprintf("--max-count=%d", count)}
+			gitArgs = append(append(append(gitArgs, revisions...), "--"), paths...)
+			return tb.git(ctx, gitArgs...)
+		},
+	}
+}
+
+// GitShow returns a tool showing a commit.
+func (tb Toolbox) GitShow() Tool {
+	return Tool{
+		Name:        "git_show",
+		Description: "Show the message and the diff of a commit.",
+		Params: []Param{
+			{"revision", "Commit to show.", String, true},
+			{"paths", "Restrict the diff to these paths.", Strings, false},
+		},
+		Run: func(ctx context.Context, args Args) (string, error) {
+			revisions, err := revisionArg(args, "revision")
+			if err != nil {
+				return "", err
+			}
+
+			paths, err := tb.pathsArg(args, "paths")
+			if err != nil {
+				return "", err
+			}
+
+			gitArgs := append(append(append([]string{"show"}, revisions...), "--"), paths...)
+			return tb.git(ctx, gitArgs...)
+		},
+	}
+}
+
+// Run returns a tool running the allowed commands.
+func (tb Toolbox) Run() Tool {
+	return Tool{
+		Name: "run",
+		Description: "Run a command in the root directory and return its combined output. " +
+			"Allowed commands: " + strings.Join(tb.Allowed, ", ") + ".",
+		Params: []Param{
+			{"command", "Name of the command.", String, true},
+			{"args", "Arguments of the command.", Strings, false},
+		},
+		Run: func(ctx context.Context, args Args) (string, error) {
+			command, err := args.String("command")
+			if err != nil {
+				return "", err
+			}
+			if !slices.Contains(tb.Allowed, command) {
+				return "", fmt.Errorf("command %q is not allowed", command)
+			}
+
+			cmdArgs, err := args.Strings("args")
+			if err != nil {
+				return "", err
+			}
+
+			ctx, cancel := context.WithTimeout(ctx, runTimeout)
+			defer cancel()
+
+			cmd := exec.CommandContext(ctx, command, cmdArgs...)
+			cmd.Dir = tb.Root
+			output, err := cmd.CombinedOutput()
+			if err != nil {
+				return "", fmt.Errorf("%s failed: %w:\n%s", command, err, output)
+			}
+
+			return string(output), nil
+		},
+	}
+}
+
+///////////////////////
+// Utility functions //
+
+// pathArg returns the resolved path of a string argument, the root when absent.
+func (tb Toolbox) pathArg(args Args, name string) (string, error) {
+	path, err := args.String(name)
+	if err != nil {
+		return "", err
+	}
+
+	if path == "" {
+		path = "."
+	}
+
+	return tb.resolve(path)
+}
+
+// revisionArg returns a string argument as a list of zero or one revision, rejecting values that
+// git would interpret as options.
+func revisionArg(args Args, name string) ([]string, error) {
+	revision, err := args.String(name)
+	if err != nil || revision == "" {
+		return nil, err
+	}
+
+	if strings.HasPrefix(revision, "-") {
+		return nil, fmt.Errorf("invalid revision %q", revision)
+	}
+
+	return []string{revision}, nil
+}
+
+// grep returns the lines matching re in the files under path, prefixed by their location.
+// Hidden directories, binary files and links leading outside of the root are skipped.
+func (tb Toolbox) grep(re *regexp.Regexp, path string, limit int) (string, error) {
+	var buf strings.Builder
+	matches := 0
+
+	root, err := filepath.Abs(tb.Root)
+	if err != nil {
+		return "", err
+	}
+
+	err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if file != path && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !tb.readable(file, entry) {
+			return nil
+		}
+
+		data, err := os.ReadFile(file)
+		if err != nil || bytes.IndexByte(data[:min(len(data), 8000)], 0) >= 0 {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			rel = file
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for line := 1; scanner.Scan(); line++ {
+			if !re.MatchString(scanner.Text()) {
+				continue
+			}
+
+			if matches == limit {
+				fmt.Fprintf(&buf, "(stopped after %d matches)\n", limit)
+				return filepath.SkipAll
+			}
+
+			fmt.Fprintf(&buf, "%s:%d: %s\n", rel, line, scanner.Text())
+			matches++
+		}
+
+		return nil
+	})
+
+	if matches == 0 && err == nil {
+		return "no match", nil
+	}
+
+	return buf.String(), err
+}
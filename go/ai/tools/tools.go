@@ -0,0 +1,200 @@
+// Package tools defines local tools that models can call, such as reading files or git diffs.
+package tools
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Tool is a function that can be called by a model.
+type Tool struct {
+	// Name identifies the tool.
+	Name string
+	// Description tells the model what the tool does.
+	Description string
+	// Params are the parameters of the tool.
+	Params []Param
+	// Run executes the tool and returns its textual output.
+	Run func(ctx context.Context, args Args) (string, error)
+}
+
+// Param is a parameter of a tool.
+type Param struct {
+	Name        string
+	Description string
+	// Type is the JSON schema type of the parameter (string, integer, boolean or array of strings).
+	Type     string
+	Required bool
+}
+
+// Parameter types.
+const (
+	String  = "string"
+	Integer = "integer"
+	Boolean = "boolean"
+	Strings = "array"
+)
+
+// Schema returns the JSON schema of the tool parameters.
+func (tool Tool) Schema() map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+
+	for _, param := range tool.Params {
+		property := map[string]any{"type": param.Type, "description": param.Description}
+		if param.Type == Strings {
+			property["items"] = map[string]string{"type": String}
+		}
+		properties[param.Name] = property
+
+		if param.Required {
+			required = append(required, param.Name)
+		}
+	}
+
+	return map[string]any{"type": "object", "properties": properties, "required": required}
+}
+
+// Call validates the arguments against the parameters and runs the tool.
+func (tool Tool) Call(ctx context.Context, args Args) (string, error) {
+	known := map[string]bool{}
+	for _, param := range tool.Params {
+		known[param.Name] = true
+		if _, exists := args[param.Name]; param.Required && !exists {
+			return "", fmt.Errorf("%s: missing required argument %q", tool.Name, param.Name)
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(args)) {
+		if !known[name] {
+			return "", fmt.Errorf("%s: unknown argument %q", tool.Name, name)
+		}
+	}
+
+	return tool.Run(ctx, args)
+}
+
+// Set is a collection of tools indexed by name.
+type Set map[string]Tool
+
+// NewSet returns a set containing the given tools.
+func NewSet(tools ...Tool) Set {
+	res := Set{}
+	for _, tool := range tools {
+		res[tool.Name] = tool
+	}
+
+	return res
+}
+
+// Sorted returns the tools sorted by name.
+func (set Set) Sorted() []Tool {
+	res := []Tool{}
+	for _, name := range slices.Sorted(maps.Keys(set)) {
+		res = append(res, set[name])
+	}
+
+	return res
+}
+
+// Call runs the tool with the given name.
+func (set Set) Call(ctx context.Context, name string, args Args) (string, error) {
+	tool, exists := set[name]
+	if !exists {
+		return "", fmt.Errorf("unknown tool: %s", name)
+	}
+
+	return tool.Call(ctx, args)
+}
+
+//////////
+// Args //
+
+// Args are the arguments of a tool call, as decoded from JSON.
+type Args map[string]any
+
+// String returns the string argument with the given name, empty if absent.
+func (args Args) String(name string) (string, error) {
+	value, exists := args[name]
+	if !exists {
+		return "", nil
+	}
+
+	res, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("argument %q must be a string, got %T", name, value)
+	}
+
+	return res, nil
+}
+
+// Strings returns the string array argument with the given name, nil if absent.
+func (args Args) Strings(name string) ([]string, error) {
+	value, exists := args[name]
+	if !exists {
+		return nil, nil
+	}
+
+	var res []string
+	switch concrete := value.(type) {
+	case []string:
+		return concrete, nil
+	case []any:
+		for _, elem := range concrete {
+			str, ok := elem.(string)
+			if !ok {
+				return nil, fmt.Errorf("argument %q must only contain strings, got %T", name, elem)
+			}
+			res = append(res, str)
+		}
+		return res, nil
+	}
+
+	return nil, fmt.Errorf("argument %q must be an array of strings, got %T", name, value)
+}
+
+// Bool returns the boolean argument with the given name, false if absent.
+func (args Args) Bool(name string) (bool, error) {
+	value, exists := args[name]
+	if !exists {
+		return false, nil
+	}
+
+	res, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("argument %q must be a boolean, got %T", name, value)
+	}
+
+	return res, nil
+}
+
+// Int returns the integer argument with the given name, def if absent.
+func (args Args) Int(name string, def int) (int, error) {
+	value, exists := args[name]
+	if !exists {
+		return def, nil
+	}
+
+	switch concrete := value.(type) {
+	case int:
+		return concrete, nil
+	case float64: // JSON numbers.
+		if concrete == float64(int(concrete)) {
+			return int(concrete), nil
+		}
+	}
+
+	return 0, fmt.Errorf("argument %q must be an integer, got %v", name, value)
+}
+
+// Positive returns the positive integer argument with the given name, def if absent.
+func (args Args) Positive(name string, def int) (int, error) {
+	res, err := args.Int(name, def)
+	if err == nil && res < 1 {
+		return 0, fmt.Errorf("argument %q must be positive, got %d", name, res)
+	}
+
+	return res, err
+}
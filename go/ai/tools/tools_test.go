@@ -0,0 +1,117 @@
+//nolint:revive
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// sandbox creates a root with a file, a link inside the root and a link to a secret outside of it.
+func sandbox(t *testing.T) Toolbox {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	secret := filepath.Join(dir, "secret")
+	for path, content := range map[string]string{
+		filepath.Join(root, "src", "main.go"): "package main // needle\n",
+		secret:                                "password needle\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	links := map[string]string{"src/escape": secret, "src/inside": "main.go", "outside": dir}
+	for link, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skipf("Symbolic links are not supported: %v", err)
+		}
+	}
+
+	return Toolbox{Root: root}
+}
+
+func TestResolve(t *testing.T) {
+	tb := sandbox(t)
+	tests := []struct {
+		name        string
+		path        string
+		expectError bool
+	}{
+		{"Relative", "src/main.go", false},
+		{"Root", ".", false},
+		{"Absolute inside", filepath.Join(tb.Root, "src"), false},
+		{"Missing file", "src/new.go", false},
+		{"Link inside", "src/inside", false},
+		{"Parent", "../secret", true},
+		{"Cleaned parent", "src/../../secret", true},
+		{"Absolute outside", "/etc/passwd", true},
+		{"Link to a file outside", "src/escape", true},
+		{"Link to a directory outside", "outside/secret", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tb.resolve(tt.path)
+			if tt.expectError != (err != nil) {
+				t.Errorf("Expected error to be %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestSymlinkEscape(t *testing.T) {
+	tb := sandbox(t)
+	tests := []struct {
+		tool string
+		args Args
+	}{
+		{"read_dir", Args{"paths": []any{"src"}}},
+		{"read_dir", Args{"paths": []any{"."}}},
+		{"grep", Args{"pattern": "needle"}},
+		{"grep", Args{"pattern": "needle", "path": "src"}},
+	}
+
+	set := NewSet(append(tb.Context(), tb.Local()...)...)
+	for _, tt := range tests {
+		t.Run(tt.tool, func(t *testing.T) {
+			res, err := set.Call(context.Background(), tt.tool, tt.args)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !strings.Contains(res, "package main") {
+				t.Errorf("Expected the files of the root, got:\n%s", res)
+			}
+			if strings.Contains(res, "password") {
+				t.Errorf("Expected the linked secret to be skipped, got:\n%s", res)
+			}
+		})
+	}
+}
+
+func TestNegativeLimits(t *testing.T) {
+	tb := sandbox(t)
+	tests := []struct {
+		tool string
+		args Args
+	}{
+		{"grep", Args{"pattern": "needle", "max_results": -1}},
+		{"grep", Args{"pattern": "needle", "max_results": 0}},
+		{"git_log", Args{"max_count": -5}},
+	}
+
+	set := NewSet(tb.Local()...)
+	for _, tt := range tests {
+		t.Run(tt.tool, func(t *testing.T) {
+			_, err := set.Call(context.Background(), tt.tool, tt.args)
+			if err == nil || !strings.Contains(err.Error(), "must be positive") {
+				t.Errorf("Expected the limit to be rejected, got %v", err)
+			}
+		})
+	}
+}
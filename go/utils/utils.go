@@ -3,8 +3,12 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 
 	"gopkg.in/yaml.v3"
@@ -69,3 +73,70 @@ func OnceErr[T any](mk func() (T, error)) func() (T, error) {
 		return res.value, res.err
 	}
 }
+
+// Tokens estimates the number of tokens of a text, at four characters per token.
+func Tokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// SplitBefore splits the text before each occurrence of separator, except at its very start.
+// Concatenating the parts gives back the text.
+func SplitBefore(text, separator string) []string {
+	var res []string
+	for {
+		index := strings.Index(text[min(1, len(text)):], separator)
+		if index < 0 {
+			break
+		}
+
+		res = append(res, text[:index+1])
+		text = text[index+1:]
+	}
+
+	if text != "" {
+		res = append(res, text)
+	}
+
+	return res
+}
+
+// SplitBeforeLines splits the text before each line starting with prefix, except the first one.
+// Concatenating the parts gives back the text.
+func SplitBeforeLines(text, prefix string) []string {
+	res := SplitBefore(text, "\n"+prefix)
+	for i := 1; i < len(res); i++ { // Moves the newline to the end of the previous line.
+		res[i-1] += "\n"
+		res[i] = res[i][1:]
+	}
+
+	return res
+}
+
+// InTree returns an error when writing to path, relative to root, would leave root by following a
+// symbolic link, be it the file itself or one of its directories.
+// The missing parts of the path are checked from their closest existing parent.
+func InTree(root, path string) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return err
+	}
+
+	for existing := filepath.Join(root, path); ; existing = filepath.Dir(existing) {
+		resolved, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if rel, err := filepath.Rel(root, resolved); err != nil || !filepath.IsLocal(rel) {
+				return fmt.Errorf("%s leads outside of the working tree through a symbolic link", path)
+			}
+			return nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if _, err := os.Lstat(existing); err == nil {
+			return fmt.Errorf("%s goes through the broken symbolic link %s", path, existing)
+		}
+	}
+}